@@ -0,0 +1,319 @@
+// admin.go contains an optional HTTP API, which allows feeds to be
+// listed, added, removed, and scanned, while we're running:
+//
+//    GET    /feeds                    - list the feeds we monitor.
+//    POST   /feeds                    - add a feed, given as JSON.
+//    DELETE /feeds?feed=...&hook=...  - remove a feed added via the API.
+//    POST   /scan?feed=...            - scan the given feed immediately.
+//
+// A feed is added by posting an object such as:
+//
+//    {"feed": "https://example.com/feed.rss",
+//     "hook": "https://ntfy.sh/example",
+//     "options": ["type: ntfy", "priority: high"]}
+//
+// Every request must carry the admin token, as a bearer token.  Feeds
+// added via the API are persisted beneath ~/.rss2hook/, rather than in
+// the configuration files, and are loaded along with them upon startup.
+//
+
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// adminFeed is a feed, and hook, as added via the admin API.
+type adminFeed struct {
+	Feed    string   `json:"feed"`
+	Hook    string   `json:"hook"`
+	Options []string `json:"options,omitempty"`
+}
+
+// adminFeeds holds the feeds added via the admin API, as they were
+// given, so that they may be persisted.
+var adminFeeds = struct {
+	sync.Mutex
+	feeds []adminFeed
+}{}
+
+// adminFile returns the path of the file holding the feeds added via the
+// admin API.
+func adminFile() string {
+	return os.Getenv("HOME") + "/.rss2hook/admin.json"
+}
+
+// saveAdminFeeds persists the feeds added via the admin API.
+//
+// The caller must hold the lock of adminFeeds.
+func saveAdminFeeds() error {
+	data, err := json.MarshalIndent(adminFeeds.feeds, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file := adminFile()
+	err = os.MkdirAll(filepath.Dir(file), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	// The hooks and options may contain credentials.
+	return ioutil.WriteFile(file, data, 0600)
+}
+
+// adminEntry returns the entry for the given feed added via the admin
+// API, with its options applied.
+func adminEntry(f adminFeed) (RSSEntry, error) {
+	if f.Feed == "" || f.Hook == "" {
+		return RSSEntry{}, fmt.Errorf("both feed and hook are required")
+	}
+
+	entry, err := newEntry(f.Feed, f.Hook)
+	if err != nil {
+		return entry, err
+	}
+	for _, option := range f.Options {
+		err = parseOption(&entry, option)
+		if err != nil {
+			return entry, err
+		}
+	}
+	err = checkOptions(entry)
+	if err != nil {
+		return entry, err
+	}
+	entry.admin = true
+	applyHookBase(&entry)
+	return resolveOptions(entry), nil
+}
+
+// loadAdminFeeds loads the feeds added via the admin API, appending them
+// to those we monitor unless they're already present.
+func loadAdminFeeds() {
+	data, err := ioutil.ReadFile(adminFile())
+	if err != nil {
+		return
+	}
+
+	adminFeeds.Lock()
+	defer adminFeeds.Unlock()
+
+	err = json.Unmarshal(data, &adminFeeds.feeds)
+	if err != nil {
+		fmt.Printf("Error reading %s - %s\n", adminFile(), err.Error())
+		return
+	}
+
+	for _, f := range adminFeeds.feeds {
+		entry, err := adminEntry(f)
+		if err != nil {
+			fmt.Printf("Error in %s - %s\n", adminFile(), err.Error())
+			continue
+		}
+		if findEntry(entry.feed, entry.hook) >= 0 {
+			fmt.Printf("Ignoring duplicate entry %s = %s in %s\n",
+				redactCredentials(entry.feed), entry.hook, adminFile())
+			continue
+		}
+		Loaded = append(Loaded, entry)
+	}
+}
+
+// findEntry returns the index, within Loaded, of the entry with the given
+// feed and hook, or -1 if there is none.
+func findEntry(feed string, hook string) int {
+	for i, entry := range Loaded {
+		if entry.feed == feed && entry.hook == hook {
+			return i
+		}
+	}
+	return -1
+}
+
+// adminReply writes the given value to the caller as JSON.
+func adminReply(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// adminError writes the given error to the caller.
+func adminError(w http.ResponseWriter, status int, err error) {
+	adminReply(w, status, map[string]string{"error": err.Error()})
+}
+
+// listAdminFeeds writes the feeds we monitor to the caller, with the
+// values of secret options, and any credentials within feeds, redacted.
+func listAdminFeeds(w http.ResponseWriter) {
+	type listed struct {
+		adminFeed
+		Admin bool `json:"admin"`
+	}
+
+	feeds := []listed{}
+	for _, entry := range loadedEntries() {
+		l := listed{adminFeed: adminFeed{Feed: redactCredentials(entry.feed), Hook: entry.hook}, Admin: entry.admin}
+		for _, option := range entry.options {
+			l.Options = append(l.Options, showOption(option))
+		}
+		feeds = append(feeds, l)
+	}
+	adminReply(w, http.StatusOK, feeds)
+}
+
+// addAdminFeed adds the feed given in the body of the request.
+func addAdminFeed(w http.ResponseWriter, r *http.Request) {
+	var f adminFeed
+	err := json.NewDecoder(r.Body).Decode(&f)
+	if err != nil {
+		adminError(w, http.StatusBadRequest, fmt.Errorf("malformed feed - %s", err.Error()))
+		return
+	}
+
+	entry, err := adminEntry(f)
+	if err != nil {
+		adminError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	LoadedLock.Lock()
+	defer LoadedLock.Unlock()
+	adminFeeds.Lock()
+	defer adminFeeds.Unlock()
+
+	if findEntry(entry.feed, entry.hook) >= 0 {
+		adminError(w, http.StatusConflict, fmt.Errorf("%s = %s is already present", redactCredentials(entry.feed), entry.hook))
+		return
+	}
+
+	adminFeeds.feeds = append(adminFeeds.feeds, f)
+	err = saveAdminFeeds()
+	if err != nil {
+		adminFeeds.feeds = adminFeeds.feeds[:len(adminFeeds.feeds)-1]
+		adminError(w, http.StatusInternalServerError, err)
+		return
+	}
+	Loaded = append(Loaded, entry)
+
+	fmt.Printf("Admin: added feed %s\nPosting to %s\n\n", redactCredentials(entry.feed), entry.hook)
+	adminReply(w, http.StatusCreated, adminFeed{Feed: redactCredentials(entry.feed), Hook: entry.hook})
+}
+
+// removeAdminFeed removes the feed given by the query of the request,
+// which must have been added via the admin API.
+func removeAdminFeed(w http.ResponseWriter, r *http.Request) {
+	feed := r.URL.Query().Get("feed")
+	hook := r.URL.Query().Get("hook")
+
+	LoadedLock.Lock()
+	defer LoadedLock.Unlock()
+	adminFeeds.Lock()
+	defer adminFeeds.Unlock()
+
+	i := findEntry(feed, hook)
+	if i < 0 {
+		adminError(w, http.StatusNotFound, fmt.Errorf("%s = %s is not present", redactCredentials(feed), hook))
+		return
+	}
+	if !Loaded[i].admin {
+		adminError(w, http.StatusConflict, fmt.Errorf("%s = %s is in a configuration file, and must be removed from there", redactCredentials(feed), hook))
+		return
+	}
+
+	kept := []adminFeed{}
+	for _, f := range adminFeeds.feeds {
+		entry, err := adminEntry(f)
+		if err == nil && entry.feed == feed && entry.hook == hook {
+			continue
+		}
+		kept = append(kept, f)
+	}
+	previous := adminFeeds.feeds
+	adminFeeds.feeds = kept
+	err := saveAdminFeeds()
+	if err != nil {
+		adminFeeds.feeds = previous
+		adminError(w, http.StatusInternalServerError, err)
+		return
+	}
+	Loaded = append(Loaded[:i], Loaded[i+1:]...)
+
+	fmt.Printf("Admin: removed feed %s, posting to %s\n", redactCredentials(feed), hook)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// scanAdminFeed immediately scans the feed given by the query of the
+// request, notifying any new items.
+func scanAdminFeed(w http.ResponseWriter, r *http.Request) {
+	feed := r.URL.Query().Get("feed")
+
+	var entries []RSSEntry
+	for _, entry := range loadedEntries() {
+		if entry.feed == feed {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) == 0 {
+		adminError(w, http.StatusNotFound, fmt.Errorf("%s is not present", redactCredentials(feed)))
+		return
+	}
+
+	ScanLock.Lock()
+	quiet := inQuietHours(time.Now())
+	for _, entry := range entries {
+		checkFeed(entry, quiet)
+	}
+	notifyHeld()
+	ScanLock.Unlock()
+	updateSeenMetrics()
+
+	adminReply(w, http.StatusOK, map[string]int{"scanned": len(entries)})
+}
+
+// adminHandler authenticates requests to the admin API, with the given
+// token, and dispatches them.
+func adminHandler(token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			adminError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+			return
+		}
+
+		switch {
+		case r.URL.Path == "/feeds" && r.Method == "GET":
+			listAdminFeeds(w)
+		case r.URL.Path == "/feeds" && r.Method == "POST":
+			addAdminFeed(w, r)
+		case r.URL.Path == "/feeds" && r.Method == "DELETE":
+			removeAdminFeed(w, r)
+		case r.URL.Path == "/scan" && r.Method == "POST":
+			scanAdminFeed(w, r)
+		case r.URL.Path == "/feeds" || r.URL.Path == "/scan":
+			adminError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		default:
+			adminError(w, http.StatusNotFound, fmt.Errorf("no such endpoint %s", r.URL.Path))
+		}
+	}
+}
+
+// serveAdmin launches a HTTP-server upon the given address, which will
+// serve the admin API to callers presenting the given token.
+func serveAdmin(addr string, token string) {
+	go func() {
+		err := http.ListenAndServe(addr, adminHandler(token))
+		if err != nil {
+			fmt.Printf("Error serving admin API on %s - %s\n", addr, err.Error())
+		}
+	}()
+}
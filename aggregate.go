@@ -0,0 +1,185 @@
+// aggregate.go contains the code which serves the items we've most
+// recently notified, across all feeds, as a single JSON Feed.
+//
+// This allows another reader to follow the consolidated stream of items
+// rss2hook has seen, rather than each of the feeds it monitors.
+//
+// The items are persisted, so that the feed survives restarts.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// AggregateSize is the number of recently notified items which are
+// retained, and served.
+const AggregateSize = 100
+
+// recentItem is an item we've notified.
+type recentItem struct {
+	// Feed is the URL of the feed the item appeared in.
+	Feed string `json:"feed"`
+
+	// ID, Title, and Link, are those of the item.
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	Link  string `json:"link"`
+
+	// Date is the canonical time of the item, or the time it was
+	// notified if it has none.
+	Date time.Time `json:"date"`
+}
+
+// recent holds the items we've most recently notified, newest first.
+var recent = struct {
+	sync.Mutex
+	items []recentItem
+}{}
+
+// aggregating is set if the aggregate feed is being served, and so the
+// items we notify should be recorded.
+var aggregating bool
+
+// recentFile returns the path of the file holding the items we've
+// recently notified.
+func recentFile() string {
+	return os.Getenv("HOME") + "/.rss2hook/recent.json"
+}
+
+// loadRecent loads the items we've recently notified.
+func loadRecent() {
+	recent.Lock()
+	defer recent.Unlock()
+
+	data, err := ioutil.ReadFile(recentFile())
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(data, &recent.items)
+}
+
+// recordRecent records that the given item, of the given feed, has
+// been notified.
+func recordRecent(entry RSSEntry, item *gofeed.Item) {
+	if !aggregating {
+		return
+	}
+
+	// The aggregate feed mustn't show what the hook didn't see.
+	item, err := redactItem(entry, item)
+	if err != nil {
+		return
+	}
+
+	r := recentItem{
+		Feed:  redactCredentials(entry.feed),
+		ID:    item.GUID,
+		Title: item.Title,
+		Link:  item.Link,
+		Date:  time.Now(),
+	}
+	if r.ID == "" {
+		r.ID = item.Link
+	}
+	if t := itemTime(entry, item); t != nil {
+		r.Date = *t
+	}
+
+	recent.Lock()
+	defer recent.Unlock()
+
+	recent.items = append([]recentItem{r}, recent.items...)
+	if len(recent.items) > AggregateSize {
+		recent.items = recent.items[:AggregateSize]
+	}
+
+	data, err := json.Marshal(recent.items)
+	if err == nil {
+		file := recentFile()
+		os.MkdirAll(filepath.Dir(file), os.ModePerm)
+		err = ioutil.WriteFile(file, data, 0644)
+	}
+	if err != nil {
+		fmt.Printf("Error saving recent items - %s\n", err.Error())
+	}
+}
+
+// AggregateHandler writes the items we've recently notified to the
+// caller, as a JSON Feed.
+//
+// See https://jsonfeed.org/version/1.1 for the format.
+func AggregateHandler(w http.ResponseWriter, r *http.Request) {
+
+	type jsonItem struct {
+		ID            string `json:"id"`
+		URL           string `json:"url,omitempty"`
+		Title         string `json:"title,omitempty"`
+		ContentText   string `json:"content_text"`
+		DatePublished string `json:"date_published"`
+
+		// Extensions are prefixed with an underscore.
+		Source struct {
+			Feed string `json:"feed"`
+		} `json:"_rss2hook"`
+	}
+	type jsonFeed struct {
+		Version string     `json:"version"`
+		Title   string     `json:"title"`
+		FeedURL string     `json:"feed_url,omitempty"`
+		Items   []jsonItem `json:"items"`
+	}
+
+	feed := jsonFeed{
+		Version: "https://jsonfeed.org/version/1.1",
+		Title:   "rss2hook",
+		Items:   []jsonItem{},
+	}
+	if r.Host != "" {
+		feed.FeedURL = "http://" + r.Host + r.URL.Path
+	}
+
+	recent.Lock()
+	for _, item := range recent.items {
+		i := jsonItem{
+			ID:            item.ID,
+			URL:           item.Link,
+			Title:         item.Title,
+			ContentText:   item.Title,
+			DatePublished: item.Date.UTC().Format(time.RFC3339),
+		}
+		i.Source.Feed = item.Feed
+		feed.Items = append(feed.Items, i)
+	}
+	recent.Unlock()
+
+	w.Header().Set("Content-Type", "application/feed+json")
+	json.NewEncoder(w).Encode(feed)
+}
+
+// serveAggregate launches a HTTP-server upon the given address, which
+// will serve the aggregate feed at `/feed.json`.
+func serveAggregate(addr string) {
+	aggregating = true
+	loadRecent()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/feed.json", AggregateHandler)
+
+	go func() {
+		err := http.ListenAndServe(addr, mux)
+		if err != nil {
+			fmt.Printf("Error serving aggregate feed on %s - %s\n", addr, err.Error())
+		}
+	}()
+}
@@ -0,0 +1,42 @@
+// archive.go contains the code which forwards the body of each feed, as
+// fetched, to an archival hook.
+//
+// This is independent of the notification of items; the body is
+// forwarded upon every successful fetch, whether or not it contains new
+// items.
+//
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// archiveFeed posts the given body, fetched from the feed of the given
+// entry, to the entry's archive-hook.
+//
+// Failures are logged, but otherwise ignored.
+func archiveFeed(entry RSSEntry, body []byte, contentType string, fetched time.Time) {
+
+	req, err := http.NewRequest("POST", entry.archiveHook, bytes.NewReader(body))
+	if err != nil {
+		fmt.Printf("Error archiving %s - %s\n", redactCredentials(entry.feed), err.Error())
+		return
+	}
+
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Feed-URL", redactCredentials(entry.feed))
+	req.Header.Set("X-Fetched-At", fetched.UTC().Format(time.RFC3339))
+
+	err = deliver(entry, req, nil)
+	if err != nil {
+		fmt.Printf("Error archiving %s to %s - %s\n",
+			redactCredentials(entry.feed), redactCredentials(entry.archiveHook), err.Error())
+	}
+}
@@ -0,0 +1,143 @@
+// batch.go contains the code for submitting all the new items of a
+// feed to its hook at once, rather than one at a time.
+//
+// A batch is submitted as a single JSON object, which carries the
+// metadata of the feed once, with the items nested beneath it:
+//
+//    {
+//      "feed": {
+//        "url": "https://example.com/feed.rss",
+//        "title": "Example",
+//        "description": "An example feed",
+//        "link": "https://example.com/",
+//        "language": "en",
+//        "updated": "2020-01-02T03:04:05Z"
+//      },
+//      "items": [ ... ]
+//    }
+//
+// Each item has the same form as when it is submitted alone.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// BatchFeed is the metadata of the feed a batch of items came from.
+type BatchFeed struct {
+	// URL is the URL the feed was fetched from.
+	URL string `json:"url"`
+
+	// Title, Description, Link, and Language are those of the feed.
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Link        string `json:"link,omitempty"`
+	Language    string `json:"language,omitempty"`
+
+	// Updated is the time the feed was last updated, in RFC3339 format
+	// if it could be parsed.
+	Updated string `json:"updated,omitempty"`
+}
+
+// Batch is the object submitted to a webhook when several new items
+// appear in a feed which is batched.
+type Batch struct {
+	Feed  BatchFeed  `json:"feed"`
+	Items []*Payload `json:"items"`
+}
+
+// newBatch creates the batch for the given items of the given feed, with
+// the given priorities.
+func newBatch(entry RSSEntry, feed *gofeed.Feed, items []*gofeed.Item, priorities []int) *Batch {
+	b := &Batch{
+		Feed: BatchFeed{
+			URL:         redactCredentials(entry.feed),
+			Title:       feed.Title,
+			Description: feed.Description,
+			Link:        feed.Link,
+			Language:    feed.Language,
+			Updated:     feed.Updated,
+		},
+	}
+	if feed.UpdatedParsed != nil {
+		b.Feed.Updated = feed.UpdatedParsed.UTC().Format(time.RFC3339)
+	}
+
+	for i, item := range items {
+		b.Items = append(b.Items, newPayload(entry, item, priorities[i]))
+	}
+	return b
+}
+
+// batched returns true if the new items of the given entry should be
+// submitted as a batch.
+//
+// Only JSON hooks support batches, other types of hook are always sent
+// one item at a time.
+func batched(entry RSSEntry) bool {
+	return entry.batch && entry.hookType == "http"
+}
+
+// notifyBatch submits the given items, of the given feed, to the hook
+// of the specified entry as a single batch, or to its fallback hook if
+// that fails.
+func notifyBatch(entry RSSEntry, feed *gofeed.Feed, items []*gofeed.Item) error {
+	return withFallback(entry, func(e RSSEntry) error {
+		return notifyBatchHook(e, feed, items)
+	})
+}
+
+// notifyBatchHook submits the given items, of the given feed, to the
+// hook of the specified entry as a single batch.
+func notifyBatchHook(entry RSSEntry, feed *gofeed.Feed, items []*gofeed.Item) error {
+
+	// Wait for a free slot, if notifications are limited.
+	if NotifySlots != nil {
+		NotifySlots <- struct{}{}
+		defer func() { <-NotifySlots }()
+	}
+
+	// Remove anything we shouldn't submit, having found the priority
+	// of each item as published.
+	var redacted []*gofeed.Item
+	var priorities []int
+	for _, item := range items {
+		priorities = append(priorities, itemPriority(entry, item))
+		item, err := redactItem(entry, item)
+		if err != nil {
+			fmt.Printf("notify: Failed to redact item:%s\n", err.Error())
+			return err
+		}
+		item, err = retitleItem(entry, item)
+		if err != nil {
+			fmt.Printf("notify: Failed to render title:%s\n", err.Error())
+			return err
+		}
+		redacted = append(redacted, item)
+	}
+
+	jsonValue, err := json.Marshal(newBatch(entry, feed, redacted, priorities))
+	if err == nil {
+		jsonValue, err = trimBatch(entry, jsonValue)
+	}
+	if err != nil {
+		fmt.Printf("notify: Failed to encode JSON:%s\n", err.Error())
+		return err
+	}
+
+	// Pass it through the transform hook, if there is one.
+	jsonValue, err = transformPayload(entry, jsonValue)
+	if err != nil {
+		return err
+	}
+
+	// Templated hooks are rendered per item, so can't be batched; see
+	// parseOption.
+	return postJSON(entry, entry.hook, jsonValue)
+}
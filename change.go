@@ -0,0 +1,81 @@
+// change.go contains the code which notifies an item again when its
+// content changes, for feeds with the notify-on-change option:
+//
+//    https://ci.example.com/status.rss = https://example.com/hook
+//     - notify-on-change: true
+//
+// This suits feeds such as a build status, whose single item flips
+// between passing and failing while keeping the same GUID.
+//
+// A hash of the content of each item is recorded when it is seen, and
+// the item is treated as new again whenever the hash differs, whatever
+// its timestamps claim.
+//
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// contentChanged returns true if the given item, of the given entry, has
+// been seen, but its content has changed since.
+//
+// Items seen before the option was set have no hash recorded, and are
+// treated as unchanged.
+func contentChanged(entry RSSEntry, item *gofeed.Item) bool {
+	if !entry.notifyOnChange {
+		return false
+	}
+
+	hash, ok := loadFeedState(seenParent(entry)).Hashes[seenKey(entry, item)]
+	return ok && hash != itemHash(item)
+}
+
+// needsNotify returns true if the given item, of the given entry, is
+// new, or has changed since it was seen.
+func needsNotify(entry RSSEntry, item *gofeed.Item) bool {
+	return isNew(entry, item) || contentChanged(entry, item)
+}
+
+// recordHash records the hash of the content of the given item, of the
+// given entry, as it is seen.
+func recordHash(entry RSSEntry, item *gofeed.Item) {
+	parent := seenParent(entry)
+	state := loadFeedState(parent)
+	if state.Hashes == nil {
+		state.Hashes = make(map[string]string)
+	}
+	state.Hashes[seenKey(entry, item)] = itemHash(item)
+
+	err := saveFeedState(parent, state)
+	if err != nil {
+		fmt.Printf("Error saving state of %s - %s\n", redactCredentials(parent), err.Error())
+	}
+}
+
+// updateHashes records the hashes of the given items, of the given
+// entry, which have been seen but have none, and forgets those of items
+// no longer in the feed.
+func updateHashes(entry RSSEntry, items []*gofeed.Item) {
+	parent := seenParent(entry)
+	state := loadFeedState(parent)
+
+	hashes := make(map[string]string)
+	for _, i := range items {
+		key := seenKey(entry, i)
+		if hash, ok := state.Hashes[key]; ok {
+			hashes[key] = hash
+		} else if !isNew(entry, i) {
+			hashes[key] = itemHash(i)
+		}
+	}
+	state.Hashes = hashes
+
+	err := saveFeedState(parent, state)
+	if err != nil {
+		fmt.Printf("Error saving state of %s - %s\n", redactCredentials(parent), err.Error())
+	}
+}
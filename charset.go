@@ -0,0 +1,75 @@
+// charset.go contains the code which converts the bodies of feeds into
+// UTF-8, for feeds which aren't served in the encoding they declare.
+//
+// Unless overridden by the feed's charset option, the charset given in
+// the Content-Type header is used.  Otherwise the parser honours the
+// encoding of the XML declaration, as usual.
+//
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// xmlEncoding matches the encoding given by an XML declaration.
+var xmlEncoding = regexp.MustCompile(`^(\s*<\?xml[^>]*?encoding\s*=\s*)["'][^"']*["']`)
+
+// validCharset returns true if the named charset is one we can decode.
+func validCharset(name string) bool {
+	enc, _ := charset.Lookup(name)
+	return enc != nil
+}
+
+// feedCharset returns the charset the body of the feed of the given entry
+// should be decoded from, given the Content-Type it was served with, or
+// "" if the body should be parsed as it is.
+func feedCharset(entry RSSEntry, contentType string) string {
+	if entry.charset != "" {
+		return entry.charset
+	}
+
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	switch name := strings.ToLower(params["charset"]); name {
+	case "", "utf-8", "utf8", "us-ascii":
+		return ""
+	default:
+		return name
+	}
+}
+
+// decodeFeed returns the given body of the feed of the given entry,
+// converted to UTF-8 if it is served in another charset.
+//
+// The encoding of any XML declaration is replaced, so that the parser
+// doesn't attempt to convert the body again.
+func decodeFeed(entry RSSEntry, contentType string, body io.ReadCloser) (io.ReadCloser, error) {
+	name := feedCharset(entry, contentType)
+	if name == "" {
+		return body, nil
+	}
+	defer body.Close()
+
+	reader, err := charset.NewReaderLabel(name, body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode charset %s - %s", name, err.Error())
+	}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	data = xmlEncoding.ReplaceAll(data, []byte(`${1}"UTF-8"`))
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
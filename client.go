@@ -0,0 +1,133 @@
+// client.go contains the HTTP clients we use to fetch feeds and to
+// submit items to webhooks.
+//
+// The clients are created once, at startup, so that connections are
+// kept alive and reused between requests and polling cycles.
+//
+
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+// FetchClient is the HTTP client used to fetch remote feeds.
+var FetchClient *http.Client
+
+// HookClient is the HTTP client used to submit items to webhooks.
+var HookClient *http.Client
+
+// HookTimeout is the timeout used when submitting items to webhooks,
+// zero for none.
+var HookTimeout time.Duration
+
+// MaxIdleConns limits the number of idle connections kept open, across
+// all hosts, by each of our transports.
+var MaxIdleConns int
+
+// MaxIdleConnsPerHost limits the number of idle connections kept open
+// to a single host.
+var MaxIdleConnsPerHost int
+
+// MaxConnsPerHost limits the number of connections open to a single
+// host, with zero meaning no limit.
+var MaxConnsPerHost int
+
+// IdleConnTimeout is the time after which an idle connection is closed.
+var IdleConnTimeout time.Duration
+
+// SharedTransport is set if feeds are fetched, and items submitted to
+// webhooks, via the same transport; so that connections to hosts which
+// serve both feeds and hooks are reused by each.
+var SharedTransport bool
+
+// HookHTTP2 is set if HTTP/2 is negotiated with webhooks which support
+// it, so that deliveries to a single host are multiplexed over one
+// connection.
+var HookHTTP2 bool
+
+// newTransport returns a transport with keep-alive connection pooling
+// configured, which negotiates HTTP/2 if http2 is set.
+//
+// Our custom dialer would otherwise prevent HTTP/2 from being attempted,
+// and an empty, rather than nil, TLSNextProto disables it entirely.
+func newTransport(http2 bool) *http.Transport {
+	t := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          MaxIdleConns,
+		MaxIdleConnsPerHost:   MaxIdleConnsPerHost,
+		MaxConnsPerHost:       MaxConnsPerHost,
+		IdleConnTimeout:       IdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		ForceAttemptHTTP2:     http2,
+	}
+	if !http2 {
+		t.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	return t
+}
+
+// setupClients creates our HTTP clients.
+//
+// This must be called after the timeouts, connection limits, sharing,
+// protocols, and tracing, have been configured.
+//
+// Feeds are fetched over HTTP/1.1, as before, unless the transport is
+// shared, in which case HookHTTP2 applies to both.
+func setupClients() {
+	fetchTransport := newTransport(SharedTransport && HookHTTP2)
+	hookTransport := fetchTransport
+	if !SharedTransport {
+		hookTransport = newTransport(HookHTTP2)
+	}
+	hookTransport.RegisterProtocol("unix", &unixTransport{})
+
+	FetchClient = &http.Client{
+		Timeout:   Timeout,
+		Transport: fetchTransport,
+	}
+	HookClient = &http.Client{
+		Timeout:   HookTimeout,
+		Transport: hookTransport,
+	}
+	if TraceHooks {
+		HookClient.Transport = traceTransport{next: HookClient.Transport}
+	}
+}
+
+// fetchClient returns the client used to fetch the feed of the given
+// entry.
+//
+// This is FetchClient, unless the entry has its own timeout, in which
+// case a copy is returned which shares the same transport, and so the
+// same pool of connections.
+func fetchClient(entry RSSEntry) *http.Client {
+	if entry.timeout == 0 || entry.timeout == FetchClient.Timeout {
+		return FetchClient
+	}
+	client := *FetchClient
+	client.Timeout = entry.timeout
+	return &client
+}
+
+// hookClient returns the client used to submit items to the hook of the
+// given entry.
+//
+// This is HookClient, unless the entry has its own hook timeout, in
+// which case a copy is returned, as with fetchClient.
+func hookClient(entry RSSEntry) *http.Client {
+	if entry.hookTimeout == 0 || entry.hookTimeout == HookClient.Timeout {
+		return HookClient
+	}
+	client := *HookClient
+	client.Timeout = entry.hookTimeout
+	return &client
+}
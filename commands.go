@@ -0,0 +1,444 @@
+// commands.go contains the one-shot modes of operation, which run
+// in place of the daemon and then exit.
+//
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// replayFeed sends the items of the given feed which were published
+// within the specified duration to each of the feed's hooks.
+//
+// Items are sent regardless of whether they've been seen before, and
+// the seen-state is not updated.
+func replayFeed(url string, since time.Duration) {
+
+	found := false
+	for _, entry := range Loaded {
+		if entry.feed != url {
+			continue
+		}
+		found = true
+
+		feed, err := readFeed(entry, false)
+		if err != nil {
+			fmt.Printf("Error reading %s - %s\n", redactCredentials(entry.feed), err.Error())
+			return
+		}
+
+		cutoff := time.Now().Add(-since)
+		for _, item := range feed.Items {
+			published := itemTime(entry, item)
+			if published == nil || published.Before(cutoff) {
+				continue
+			}
+
+			err = notify(entry, item)
+			if err == nil {
+				fmt.Printf("Replayed %s to %s\n", item.Link, entry.hook)
+			}
+		}
+	}
+
+	if !found {
+		fmt.Printf("Feed %s is not present in the configuration file\n", url)
+	}
+}
+
+// markSeen records every item currently in the given feed as seen,
+// without notifying any of them.
+//
+// This avoids a backlog of notifications for a feed which has been read
+// elsewhere, or which was paused.
+func markSeen(url string) {
+
+	found := false
+	for _, entry := range Loaded {
+		if entry.feed != url {
+			continue
+		}
+		found = true
+
+		feed, err := readFeed(entry, false)
+		if err != nil {
+			fmt.Printf("Error reading %s - %s\n", redactCredentials(entry.feed), err.Error())
+			return
+		}
+
+		count := 0
+		for _, item := range uniqueItems(entry, feed.Items) {
+			if isNew(entry, item) {
+				recordSeen(entry, item)
+				count++
+			}
+		}
+		fmt.Printf("Marked %d items of %s as seen\n", count, redactCredentials(entry.feed))
+	}
+
+	if !found {
+		fmt.Printf("Feed %s is not present in the configuration file\n", url)
+	}
+}
+
+// testFilters shows whether each item currently in the given feed
+// passes the feed's filters, and why.
+//
+// Nothing is notified, and the seen-state is not updated.
+func testFilters(url string) {
+
+	found := false
+	for _, entry := range Loaded {
+		if entry.feed != url {
+			continue
+		}
+		found = true
+
+		feed, err := readFeed(entry, false)
+		if err != nil {
+			fmt.Printf("Error reading %s - %s\n", redactCredentials(entry.feed), err.Error())
+			return
+		}
+
+		fmt.Printf("Feed %s, posting to %s\n", redactCredentials(entry.feed), entry.hook)
+		for _, item := range feed.Items {
+			ok, reason := checkFilters(entry, item)
+			result := "PASS"
+			if !ok {
+				result = "SKIP"
+			}
+			fmt.Printf("%s %s - %s\n", result, item.Title, reason)
+		}
+		fmt.Printf("\n")
+	}
+
+	if !found {
+		fmt.Printf("Feed %s is not present in the configuration file\n", url)
+	}
+}
+
+// listedOptions are the options whose effective values are always
+// shown by listFeeds, whether or not they were given.
+var listedOptions = map[string]bool{
+	"type":           true,
+	"timeout":        true,
+	"hook-timeout":   true,
+	"retries":        true,
+	"cooldown":       true,
+	"dedup":          true,
+	"timestamp":      true,
+	"missing-link":   true,
+	"max-body-field": true,
+	"accept":         true,
+	"content-types":  true,
+	"deny-domain":    true,
+	"basic-auth":     true,
+}
+
+// setting is the effective value of a single setting of a feed.
+type setting struct {
+	name  string
+	value string
+}
+
+// effectiveSettings returns the settings in effect for the given entry,
+// whether they were given as options or are defaults, followed by its
+// other options.
+//
+// The values of secret options are redacted.
+func effectiveSettings(entry RSSEntry) []setting {
+	contentTypes := entry.contentTypes
+	if len(contentTypes) == 0 {
+		contentTypes = DefaultContentTypes
+	}
+	denied := append(append([]string{}, DeniedDomains...), entry.deniedDomains...)
+	hookTimeout := "none"
+	if entry.hookTimeout > 0 {
+		hookTimeout = entry.hookTimeout.String()
+	}
+
+	settings := []setting{
+		{"type", entry.hookType},
+		{"timeout", entry.timeout.String()},
+		{"hook-timeout", hookTimeout},
+		{"retries", strconv.Itoa(entry.retries)},
+		{"cooldown", entry.cooldown.String()},
+		{"dedup", entry.dedup},
+		{"timestamp", entry.timestamp},
+		{"missing-link", entry.missingLink},
+		{"max-body-field", strconv.Itoa(entry.maxBodyField)},
+		{"accept", entry.accept},
+		{"content-types", strings.Join(contentTypes, ", ")},
+	}
+	if len(denied) > 0 {
+		settings = append(settings, setting{"deny-domains", strings.Join(denied, ", ")})
+	}
+	if entry.username != "" {
+		settings = append(settings, setting{"basic-auth", Redacted})
+	}
+	for _, option := range entry.options {
+		key := strings.SplitN(option, ":", 2)[0]
+		if !listedOptions[key] {
+			shown := strings.SplitN(showOption(option), ":", 2)
+			value := ""
+			if len(shown) == 2 {
+				value = strings.TrimSpace(shown[1])
+			}
+			settings = append(settings, setting{shown[0], value})
+		}
+	}
+	return settings
+}
+
+// listFeeds shows each feed we monitor, along with the settings in
+// effect for it, whether they were given as options or are defaults.
+//
+// The values of secret options are redacted.
+func listFeeds() {
+	for _, entry := range Loaded {
+		fmt.Printf("Feed %s, posting to %s\n", redactCredentials(entry.feed), entry.hook)
+		for _, s := range effectiveSettings(entry) {
+			fmt.Printf("    %s: %s\n", s.name, s.value)
+		}
+		fmt.Printf("\n")
+	}
+}
+
+// secretFlags are the command-line flags whose values are redacted by
+// printEffectiveConfig.
+var secretFlags = map[string]bool{
+	"admin-token": true,
+}
+
+// urlFlags are the command-line flags whose values are URLs, which are
+// shown by printEffectiveConfig with any credentials they contain
+// redacted.
+var urlFlags = map[string]bool{
+	"hook-base":   true,
+	"hook-suffix": true,
+}
+
+// printEffectiveConfig shows the configuration in effect, as JSON; the
+// value of every command-line flag, whether given or a default, and
+// each feed we monitor along with its effective settings.
+//
+// The values of secret flags, and options, are redacted, as are any
+// credentials within feeds and hooks.
+func printEffectiveConfig() {
+	type feedConfig struct {
+		Feed     string                 `json:"feed"`
+		Hook     string                 `json:"hook"`
+		Admin    bool                   `json:"admin,omitempty"`
+		Settings map[string]interface{} `json:"settings"`
+	}
+	config := struct {
+		Hash  string            `json:"hash"`
+		Flags map[string]string `json:"flags"`
+		Feeds []feedConfig      `json:"feeds"`
+	}{
+		Hash:  configHash(Loaded),
+		Flags: make(map[string]string),
+		Feeds: []feedConfig{},
+	}
+
+	flag.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if secretFlags[f.Name] && value != "" {
+			value = Redacted
+		}
+		if urlFlags[f.Name] {
+			value = redactCredentials(value)
+		}
+		config.Flags[f.Name] = value
+	})
+
+	for _, entry := range Loaded {
+		fc := feedConfig{
+			Feed:     redactCredentials(entry.feed),
+			Hook:     redactCredentials(entry.hook),
+			Admin:    entry.admin,
+			Settings: make(map[string]interface{}),
+		}
+
+		// Options which are repeated have a list of values.
+		for _, s := range effectiveSettings(entry) {
+			switch value := fc.Settings[s.name].(type) {
+			case nil:
+				fc.Settings[s.name] = s.value
+			case string:
+				fc.Settings[s.name] = []string{value, s.value}
+			case []string:
+				fc.Settings[s.name] = append(value, s.value)
+			}
+		}
+		config.Feeds = append(config.Feeds, fc)
+	}
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		fmt.Printf("Error encoding configuration - %s\n", err.Error())
+		return
+	}
+	fmt.Printf("%s\n", data)
+}
+
+// redactCredentials returns the given feed, or hook, URL with any
+// credentials it contains redacted, as redactURL does, along with a
+// username given without a password, since that may be a token.
+func redactCredentials(link string) string {
+	u, err := url.Parse(link)
+	if err != nil || u.User == nil {
+		return link
+	}
+	if _, ok := u.User.Password(); !ok {
+		redacted := *u
+		redacted.User = url.User("xxxxx")
+		return redacted.String()
+	}
+	return redactURL(u)
+}
+
+// exportSeenState writes all the items we've recorded as seen to the
+// named file, as JSON.
+func exportSeenState(filename string) {
+	records, err := loadSeen()
+	if err != nil {
+		fmt.Printf("Error reading seen-state - %s\n", err.Error())
+		return
+	}
+	if records == nil {
+		records = []seenRecord{}
+	}
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		fmt.Printf("Error encoding seen-state - %s\n", err.Error())
+		return
+	}
+
+	err = ioutil.WriteFile(filename, data, 0644)
+	if err != nil {
+		fmt.Printf("Error writing %s - %s\n", filename, err.Error())
+		return
+	}
+	fmt.Printf("Exported %d items to %s\n", len(records), filename)
+}
+
+// importSeenState merges the items in the named file, as written by
+// exportSeenState, into our seen-state.
+func importSeenState(filename string) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		fmt.Printf("Error reading %s - %s\n", filename, err.Error())
+		return
+	}
+
+	var records []seenRecord
+	err = json.Unmarshal(data, &records)
+	if err != nil {
+		fmt.Printf("Error parsing %s - %s\n", filename, err.Error())
+		return
+	}
+
+	imported := 0
+	for _, record := range records {
+		if !validKey(record.Key) {
+			fmt.Printf("Ignoring invalid key %q\n", record.Key)
+			continue
+		}
+
+		var stored bool
+		stored, err = storeSeen(record)
+		if err != nil {
+			fmt.Printf("Error importing %s - %s\n", record.Key, err.Error())
+			return
+		}
+		if stored {
+			imported++
+		}
+	}
+	fmt.Printf("Imported %d of %d items from %s\n", imported, len(records), filename)
+}
+
+// validKey returns true if the given string is a valid seen-key; the
+// hex-encoded SHA1 hash of an item.
+func validKey(key string) bool {
+	if len(key) != 40 {
+		return false
+	}
+	_, err := hex.DecodeString(key)
+	return err == nil
+}
+
+// dirSize returns the number of files beneath the given directory, and
+// their total size.
+func dirSize(dir string) (int, int64) {
+	count := 0
+	var size int64
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			count++
+			size += info.Size()
+		}
+		return nil
+	})
+	return count, size
+}
+
+// showStats shows statistics of our state, and of the feeds we monitor
+// if configuration files were loaded, without modifying anything.
+//
+// Seen-keys are hashes, so the number seen for each feed is known only
+// if they're tracked, via -max-keys-per-feed.
+func showStats() {
+	records, err := loadSeen()
+	if err != nil {
+		fmt.Printf("Error reading seen-state - %s\n", err.Error())
+		return
+	}
+
+	fmt.Printf("Seen items: %d\n", len(records))
+	if len(records) > 0 {
+		oldest, newest := records[0].Seen, records[0].Seen
+		for _, r := range records {
+			if r.Seen.Before(oldest) {
+				oldest = r.Seen
+			}
+			if r.Seen.After(newest) {
+				newest = r.Seen
+			}
+		}
+		fmt.Printf("Oldest seen: %s\n", oldest.Format(time.RFC3339))
+		fmt.Printf("Newest seen: %s\n", newest.Format(time.RFC3339))
+	}
+
+	_, seenBytes := dirSize(seenDir())
+	files, stateBytes := dirSize(filepath.Dir(seenDir()))
+	fmt.Printf("Seen-state size: %d bytes\n", seenBytes)
+	fmt.Printf("Total state: %d files, %d bytes, beneath %s\n", files, stateBytes, filepath.Dir(seenDir()))
+	fmt.Printf("Go version: %s\n", runtime.Version())
+
+	if len(Loaded) == 0 {
+		return
+	}
+	fmt.Printf("Feeds: %d\n", len(Loaded))
+	for _, entry := range Loaded {
+		count := "untracked"
+		if MaxKeysPerFeed > 0 {
+			count = strconv.Itoa(len(loadFeedState(seenParent(entry)).SeenKeys))
+		}
+		fmt.Printf("    %s: %s seen\n", redactCredentials(entry.feed), count)
+	}
+}
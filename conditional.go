@@ -0,0 +1,193 @@
+// conditional.go contains the code which makes conditional requests for
+// feeds, when launched with `-conditional-get`, so that a feed which
+// hasn't changed since it was last fetched isn't downloaded again.
+//
+// The ETag, and Last-Modified time, returned with a feed are sent with
+// the next request for it, and a server may reply "304 Not Modified".
+// A server which mishandles caching might do so forever, so a full
+// request is made once -force-refresh has passed since the last.
+//
+// Validators are pruned after each poll if their feed, or hook, is no
+// longer configured, or if they haven't been refreshed within
+// -validator-ttl, so that they don't linger forever.
+//
+// The validators are only retained once every new item has been seen,
+// as an item whose notification failed must be found again upon the
+// next poll.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ConditionalGet enables conditional requests for feeds.
+var ConditionalGet bool
+
+// ForceRefresh is the interval after which a feed is fetched in full,
+// regardless of its validators, zero to never force a full request.
+var ForceRefresh time.Duration
+
+// ValidatorTTL is the time after which validators which haven't been
+// refreshed are discarded, zero to keep them while their feed is
+// configured.
+var ValidatorTTL time.Duration
+
+// errNotModified is returned when a feed hasn't changed since it was
+// last fetched.
+var errNotModified = errors.New("not modified")
+
+// validator holds what is needed to make a conditional request for a
+// feed.
+type validator struct {
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	Refreshed    time.Time `json:"refreshed"`
+}
+
+// fetched holds the validators of the feeds fetched during the current
+// poll, keyed by entryKey, until they're retained by keepValidators.
+var fetched = struct {
+	sync.Mutex
+	validators map[string]validator
+}{validators: make(map[string]validator)}
+
+// setValidators adds the headers which make the given request for the
+// feed of the given entry conditional, unless a full request is due.
+//
+// The validators are kept for each hook of a feed, as each records the
+// items it has seen separately.
+func setValidators(entry RSSEntry, req *http.Request) {
+	v, ok := loadFeedState(entry.feed).Validators[entry.hook]
+	if !ok {
+		return
+	}
+	if ForceRefresh > 0 && time.Since(v.Refreshed) >= ForceRefresh {
+		debug("Forcing a full refresh of %s\n", redactCredentials(entry.feed))
+		return
+	}
+
+	if v.ETag != "" {
+		req.Header.Set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		req.Header.Set("If-Modified-Since", v.LastModified)
+	}
+}
+
+// rememberValidators holds the validators of the given response, to a
+// request for the feed of the given entry, until the feed's items have
+// been processed.
+func rememberValidators(entry RSSEntry, resp *http.Response) {
+	v := validator{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Refreshed:    time.Now(),
+	}
+
+	fetched.Lock()
+	defer fetched.Unlock()
+
+	if v.ETag == "" && v.LastModified == "" {
+		delete(fetched.validators, entryKey(entry))
+		return
+	}
+	fetched.validators[entryKey(entry)] = v
+}
+
+// keepValidators retains the validators of the feed of the given entry,
+// from when it was last fetched, so that they're used by the next poll,
+// if every new item was seen.  Otherwise any previous validators are
+// discarded, so that the next poll makes a full request.
+func keepValidators(entry RSSEntry, complete bool) {
+	fetched.Lock()
+	v, ok := fetched.validators[entryKey(entry)]
+	delete(fetched.validators, entryKey(entry))
+	fetched.Unlock()
+
+	state := loadFeedState(entry.feed)
+	_, previous := state.Validators[entry.hook]
+	if !previous && !(ok && complete) {
+		return
+	}
+
+	if ok && complete {
+		if state.Validators == nil {
+			state.Validators = make(map[string]validator)
+		}
+		state.Validators[entry.hook] = v
+	} else {
+		delete(state.Validators, entry.hook)
+	}
+
+	err := saveFeedState(entry.feed, state)
+	if err != nil {
+		fmt.Printf("Error saving state of %s - %s\n", redactCredentials(entry.feed), err.Error())
+	}
+}
+
+// pruneValidators discards the validators of feeds, and hooks, which are
+// no longer configured, along with those which haven't been refreshed
+// within ValidatorTTL.
+//
+// The state files are named by hashes, so every file is read to find
+// those of feeds which have been removed.  Only the validators are
+// discarded, as the rest of the state may still be in use.
+func pruneValidators() {
+	hooks := make(map[string]map[string]bool)
+	for _, entry := range loadedEntries() {
+		file := feedStateFile(entry.feed)
+		if hooks[file] == nil {
+			hooks[file] = make(map[string]bool)
+		}
+		hooks[file][entry.hook] = true
+	}
+
+	dir := filepath.Dir(feedStateFile(""))
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	for _, info := range files {
+		file := filepath.Join(dir, info.Name())
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var state feedState
+		if json.Unmarshal(data, &state) != nil || len(state.Validators) == 0 {
+			continue
+		}
+
+		pruned := 0
+		for hook, v := range state.Validators {
+			stale := ValidatorTTL > 0 && time.Since(v.Refreshed) > ValidatorTTL
+			if stale || !hooks[file][hook] {
+				delete(state.Validators, hook)
+				pruned++
+			}
+		}
+		if pruned == 0 {
+			continue
+		}
+
+		data, err = json.Marshal(state)
+		if err == nil {
+			err = ioutil.WriteFile(file, data, 0644)
+		}
+		if err != nil {
+			fmt.Printf("Error pruning validators in %s - %s\n", file, err.Error())
+			continue
+		}
+		debug("Pruned %d validators from %s\n", pruned, file)
+	}
+}
@@ -0,0 +1,54 @@
+// confighash.go contains the code which computes a short hash of the
+// feeds we've been configured to monitor, so that it can be confirmed
+// that several instances are running the same configuration.
+//
+// The hash is of the entries, rather than of the files, so it isn't
+// affected by their order, whitespace, or comments, nor by the order of
+// the options of an entry with different keys; see sameOptions.
+//
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+)
+
+// configHash returns a short hash of the given entries, ignoring those
+// added via the admin API.
+//
+// Secrets are excluded, since a short unsalted hash of them could be
+// brute-forced, so instances differing only in their credentials have
+// the same hash.
+func configHash(entries []RSSEntry) string {
+	var normalized []string
+
+	for _, entry := range entries {
+		if entry.admin {
+			continue
+		}
+
+		var options []string
+		for _, option := range entry.options {
+			options = append(options, showOption(option))
+		}
+		groups := groupOptions(options)
+		var keys []string
+		for key := range groups {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		text := showEntry(entry) + "\n"
+		for _, key := range keys {
+			text += groups[key]
+		}
+		normalized = append(normalized, text)
+	}
+	sort.Strings(normalized)
+
+	sum := sha256.Sum256([]byte(strings.Join(normalized, "\n")))
+	return hex.EncodeToString(sum[:])[:12]
+}
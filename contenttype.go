@@ -0,0 +1,70 @@
+// contenttype.go contains the code which checks that the content
+// returned when fetching a feed is of a type we expect, so that error
+// pages, and other garbage, are not parsed.
+//
+
+package main
+
+import (
+	"fmt"
+	"mime"
+	"path"
+	"strings"
+)
+
+// DefaultContentTypes are the content-types accepted when fetching
+// feeds, unless overridden for a feed.
+//
+// Types may be patterns, as matched by path.Match, so that types such as
+// "application/rss+xml" and "application/x-rss+xml" are both accepted.
+var DefaultContentTypes = []string{
+	"*/*+xml",
+	"*/*+json",
+	"application/xml",
+	"text/xml",
+	"application/json",
+}
+
+// parseContentTypes splits a comma-separated list of content-types.
+func parseContentTypes(list string) []string {
+	var types []string
+	for _, t := range strings.Split(list, ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t != "" {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// checkContentType returns an error if the given content-type isn't
+// accepted for the feed of the given entry.
+//
+// A missing content-type is always accepted, as is any content-type if
+// the accepted types include "*".  HTML is accepted by default for feeds
+// with a fallback parser which reads it.
+func checkContentType(entry RSSEntry, header string) error {
+	if header == "" {
+		return nil
+	}
+
+	types := entry.contentTypes
+	if len(types) == 0 {
+		types = DefaultContentTypes
+		if parsesHTML(entry) {
+			types = append([]string{"text/html"}, types...)
+		}
+	}
+
+	media, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return fmt.Errorf("malformed content-type %s", header)
+	}
+
+	for _, t := range types {
+		if ok, _ := path.Match(t, media); ok || t == "*" {
+			return nil
+		}
+	}
+	return fmt.Errorf("unexpected content-type %s, which isn't a feed", media)
+}
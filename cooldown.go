@@ -0,0 +1,59 @@
+// cooldown.go contains the code which suppresses the re-notification of
+// items which were delivered recently.
+//
+// A feed which flaps, removing an item and then adding it again, would
+// otherwise cause the item to be notified each time it reappears once
+// its seen-key has been pruned.
+//
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// Cooldown is the period after an item is delivered during which it is
+// never delivered again, zero disables the check.
+var Cooldown time.Duration
+
+// coolingDown returns true if the given item, of the given entry, was
+// delivered within the entry's cooldown.
+func coolingDown(entry RSSEntry, item *gofeed.Item) bool {
+	if entry.cooldown <= 0 {
+		return false
+	}
+
+	state := loadFeedState(seenParent(entry))
+	delivered, ok := state.Delivered[seenKey(entry, item)]
+	return ok && time.Since(delivered) < entry.cooldown
+}
+
+// recordDelivery records that the given item, of the given entry, was
+// delivered, if the entry has a cooldown.
+//
+// Deliveries which are older than the cooldown are forgotten.
+func recordDelivery(entry RSSEntry, item *gofeed.Item) {
+	if entry.cooldown <= 0 {
+		return
+	}
+
+	parent := seenParent(entry)
+	state := loadFeedState(parent)
+	for key, delivered := range state.Delivered {
+		if time.Since(delivered) >= entry.cooldown {
+			delete(state.Delivered, key)
+		}
+	}
+	if state.Delivered == nil {
+		state.Delivered = make(map[string]time.Time)
+	}
+	state.Delivered[seenKey(entry, item)] = time.Now()
+
+	err := saveFeedState(parent, state)
+	if err != nil {
+		fmt.Printf("Error saving state of %s - %s\n", redactCredentials(parent), err.Error())
+	}
+}
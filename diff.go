@@ -0,0 +1,180 @@
+// diff.go contains the code which compares two configuration files,
+// showing the feeds which were added, removed, or changed.
+//
+// The comparison is of the entries the files contain, so changes to
+// their order, whitespace, or comments, are ignored.
+//
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// secretOptions are the options whose values are never shown.
+var secretOptions = map[string]bool{
+	"basic-auth":   true,
+	"cookie":       true,
+	"token":        true,
+	"routing-key":  true,
+	"apprise-urls": true,
+}
+
+// urlOptions are the options whose values are URLs, which are shown with
+// any credentials they contain redacted.
+var urlOptions = map[string]bool{
+	"transform-hook": true,
+	"fallback-hook":  true,
+	"archive-hook":   true,
+}
+
+// entryKey returns the key identifying the given entry when comparing
+// configuration files.
+func entryKey(entry RSSEntry) string {
+	return entry.feed + " = " + entry.hook
+}
+
+// showEntry returns the given entry, as shown when comparing
+// configuration files, with any credentials within its feed redacted.
+func showEntry(entry RSSEntry) string {
+	return redactCredentials(entry.feed) + " = " + entry.hook
+}
+
+// showOption returns the given option, in the form "key: value", with
+// its value redacted if it is a secret, or with any credentials within
+// it redacted if it is a URL.
+func showOption(option string) string {
+	parts := strings.SplitN(option, ": ", 2)
+	key := parts[0]
+	if secretOptions[key] {
+		return key + ": [redacted]"
+	}
+	if urlOptions[key] && len(parts) == 2 {
+		return key + ": " + redactCredentials(parts[1])
+	}
+	return option
+}
+
+// configEntries returns the entries of the given configuration file,
+// keyed by entryKey, along with the keys in sorted order.
+func configEntries(filename string) (map[string]RSSEntry, []string) {
+	entries := make(map[string]RSSEntry)
+	var keys []string
+
+	for _, entry := range loadConfig(filename) {
+		key := entryKey(entry)
+		if _, ok := entries[key]; ok {
+			continue
+		}
+		entries[key] = entry
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return entries, keys
+}
+
+// groupOptions returns the values of the given options, grouped by key
+// in the order they were given.
+func groupOptions(options []string) map[string]string {
+	groups := make(map[string]string)
+	for _, option := range options {
+		key := strings.SplitN(option, ":", 2)[0]
+		groups[key] += option + "\n"
+	}
+	return groups
+}
+
+// sameOptions returns true if the given options are the same.
+//
+// The order of options with different keys doesn't matter, but options
+// which may be repeated, such as priority-rule, are applied in order so
+// their order does.
+func sameOptions(old []string, new []string) bool {
+	before := groupOptions(old)
+	after := groupOptions(new)
+	if len(before) != len(after) {
+		return false
+	}
+	for key, values := range before {
+		if after[key] != values {
+			return false
+		}
+	}
+	return true
+}
+
+// diffOptions shows the options removed from, and added to, an entry.
+//
+// It returns false if the options are the same, though perhaps in a
+// different order.
+func diffOptions(old []string, new []string) bool {
+	count := make(map[string]int)
+	for _, option := range old {
+		count[option]++
+	}
+	for _, option := range new {
+		count[option]--
+	}
+
+	changed := false
+	for _, option := range old {
+		if count[option] > 0 {
+			fmt.Printf("    - %s\n", showOption(option))
+			count[option]--
+			changed = true
+		}
+	}
+	for _, option := range new {
+		if count[option] < 0 {
+			fmt.Printf("    + %s\n", showOption(option))
+			count[option]++
+			changed = true
+		}
+	}
+	return changed
+}
+
+// diffConfigs shows the entries which were added, removed, or whose
+// options changed, between the two named configuration files.
+func diffConfigs(oldFile string, newFile string) {
+	old, oldKeys := configEntries(oldFile)
+	new, newKeys := configEntries(newFile)
+
+	changes := 0
+	for _, key := range oldKeys {
+		if _, ok := new[key]; !ok {
+			fmt.Printf("- %s\n", showEntry(old[key]))
+			changes++
+		}
+	}
+	for _, key := range newKeys {
+		if _, ok := old[key]; !ok {
+			fmt.Printf("+ %s\n", showEntry(new[key]))
+			changes++
+		}
+	}
+
+	for _, key := range newKeys {
+		before, ok := old[key]
+		if !ok {
+			continue
+		}
+		after := new[key]
+
+		if sameOptions(before.options, after.options) {
+			continue
+		}
+		changes++
+
+		fmt.Printf("~ %s\n", showEntry(after))
+		if !diffOptions(before.options, after.options) {
+			fmt.Printf("    options reordered\n")
+		}
+	}
+
+	if changes == 0 {
+		fmt.Printf("No changes\n")
+	}
+}
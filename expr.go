@@ -0,0 +1,319 @@
+// expr.go contains a small expression language, used to decide whether
+// feed-items should be notified with more precision than the include
+// and exclude patterns allow, for example:
+//
+//    title contains "release" and category == "stable"
+//
+// Comparisons are of the form `field op "value"`, where op is one of
+// `==`, `!=`, `contains`, or `matches` (a regular expression), and may
+// be combined with `and`, `or`, `not`, and parentheses.  All but
+// `matches` ignore case.
+//
+// The fields are title, description, content, link, guid, author,
+// domain, and category.  An item may have several categories, and a
+// comparison against category is true if it holds for any of them.
+//
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// exprNode is a node of a parsed expression.
+type exprNode interface {
+	eval(item *gofeed.Item) bool
+}
+
+// itemExpr is a parsed expression, along with its source.
+type itemExpr struct {
+	source string
+	root   exprNode
+}
+
+// andNode is true if both of its children are.
+type andNode struct {
+	left, right exprNode
+}
+
+func (n andNode) eval(item *gofeed.Item) bool {
+	return n.left.eval(item) && n.right.eval(item)
+}
+
+// orNode is true if either of its children are.
+type orNode struct {
+	left, right exprNode
+}
+
+func (n orNode) eval(item *gofeed.Item) bool {
+	return n.left.eval(item) || n.right.eval(item)
+}
+
+// notNode is true if its child is not.
+type notNode struct {
+	child exprNode
+}
+
+func (n notNode) eval(item *gofeed.Item) bool {
+	return !n.child.eval(item)
+}
+
+// compareNode compares a field of the item with a value.
+type compareNode struct {
+	field string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+// exprFields are the fields which may be compared.
+var exprFields = map[string]bool{
+	"title": true, "description": true, "content": true, "link": true,
+	"guid": true, "author": true, "domain": true, "category": true,
+}
+
+// fieldValues returns the values of the named field of the given item.
+func fieldValues(item *gofeed.Item, field string) []string {
+	switch field {
+	case "title":
+		return []string{item.Title}
+	case "description":
+		return []string{plainText(item.Description)}
+	case "content":
+		return []string{plainText(item.Content)}
+	case "link":
+		return []string{item.Link}
+	case "guid":
+		return []string{item.GUID}
+	case "author":
+		if item.Author == nil {
+			return []string{""}
+		}
+		return []string{item.Author.Name}
+	case "domain":
+		u, err := url.Parse(item.Link)
+		if err != nil {
+			return []string{""}
+		}
+		return []string{u.Hostname()}
+	}
+	return item.Categories
+}
+
+func (n compareNode) eval(item *gofeed.Item) bool {
+
+	// "!=" is the negation of "==", so that a comparison against
+	// category is true only if no category is equal.
+	if n.op == "!=" {
+		return !compareNode{field: n.field, op: "==", value: n.value}.eval(item)
+	}
+
+	for _, value := range fieldValues(item, n.field) {
+		switch n.op {
+		case "==":
+			if strings.EqualFold(value, n.value) {
+				return true
+			}
+		case "contains":
+			if strings.Contains(strings.ToLower(value), strings.ToLower(n.value)) {
+				return true
+			}
+		case "matches":
+			if n.re.MatchString(value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// tokenizeExpr splits the given expression into its tokens; words,
+// quoted strings, parentheses, and operators.
+func tokenizeExpr(source string) ([]string, error) {
+	var tokens []string
+
+	s := source
+	for {
+		s = strings.TrimLeftFunc(s, unicode.IsSpace)
+		if s == "" {
+			return tokens, nil
+		}
+
+		switch {
+		case s[0] == '(' || s[0] == ')':
+			tokens = append(tokens, s[:1])
+			s = s[1:]
+		case strings.HasPrefix(s, "==") || strings.HasPrefix(s, "!="):
+			tokens = append(tokens, s[:2])
+			s = s[2:]
+		case s[0] == '"':
+			end := 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return nil, fmt.Errorf("unterminated string %s", s)
+			}
+			tokens = append(tokens, s[:end+1])
+			s = s[end+1:]
+		default:
+			end := strings.IndexFunc(s, func(r rune) bool {
+				return unicode.IsSpace(r) || strings.ContainsRune(`()"=!`, r)
+			})
+			if end == 0 {
+				return nil, fmt.Errorf("unexpected '%c'", s[0])
+			}
+			if end < 0 {
+				end = len(s)
+			}
+			tokens = append(tokens, s[:end])
+			s = s[end:]
+		}
+	}
+}
+
+// exprParser parses a list of tokens, by recursive descent.
+type exprParser struct {
+	tokens []string
+	pos    int
+}
+
+// peek returns the next token, without consuming it, or "" at the end.
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+// next consumes, and returns, the next token, or "" at the end.
+func (p *exprParser) next() string {
+	token := p.peek()
+	if token != "" {
+		p.pos++
+	}
+	return token
+}
+
+// parseOr parses a sequence of terms joined by "or".
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for strings.ToLower(p.peek()) == "or" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseAnd parses a sequence of terms joined by "and".
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for strings.ToLower(p.peek()) == "and" {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseUnary parses a negation, a parenthesised expression, or a
+// comparison.
+func (p *exprParser) parseUnary() (exprNode, error) {
+	token := p.next()
+
+	switch strings.ToLower(token) {
+	case "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case "not":
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{child: child}, nil
+	case "(":
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing ')'")
+		}
+		return node, nil
+	}
+
+	field := strings.ToLower(token)
+	if !exprFields[field] {
+		return nil, fmt.Errorf("unknown field '%s'", token)
+	}
+
+	op := strings.ToLower(p.next())
+	switch op {
+	case "==", "!=", "contains", "matches":
+	default:
+		return nil, fmt.Errorf("expected ==, !=, contains, or matches after '%s'", token)
+	}
+
+	quoted := p.next()
+	if !strings.HasPrefix(quoted, `"`) {
+		return nil, fmt.Errorf("expected a quoted value after '%s %s'", token, op)
+	}
+	value, err := strconv.Unquote(quoted)
+	if err != nil {
+		return nil, fmt.Errorf("invalid string %s", quoted)
+	}
+
+	node := compareNode{field: field, op: op, value: value}
+	if op == "matches" {
+		node.re, err = regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s' - %s", value, err.Error())
+		}
+	}
+	return node, nil
+}
+
+// parseExpr parses the given expression.
+func parseExpr(source string) (*itemExpr, error) {
+	tokens, err := tokenizeExpr(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected '%s'", p.peek())
+	}
+	return &itemExpr{source: source, root: root}, nil
+}
+
+// eval returns true if the given item satisfies the expression.
+func (e *itemExpr) eval(item *gofeed.Item) bool {
+	return e.root.eval(item)
+}
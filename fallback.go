@@ -0,0 +1,58 @@
+// fallback.go contains the code which delivers items to a secondary hook
+// when delivery to the primary hook of a feed fails:
+//
+//    https://example.com/feed.rss = https://primary.example.com/hook
+//     - fallback-hook: https://backup.example.com/hook
+//
+// The fallback is only tried once the primary has failed, after any
+// retries, and the item is recorded as seen if either succeeds.  The
+// fallback is of the same type, and has the same options, as the
+// primary, except for its secrets; the auth-secret, token, routing-key,
+// and apprise-urls of the primary are never sent to the fallback, whose
+// only credentials are those within its own URL.
+//
+
+package main
+
+import (
+	"fmt"
+)
+
+// fallbackEntry returns a copy of the given entry which delivers items
+// to its fallback hook.
+func fallbackEntry(entry RSSEntry) (RSSEntry, error) {
+	fallback, err := newEntry(entry.feed, entry.fallbackHook)
+	if err != nil {
+		return entry, err
+	}
+
+	entry.hook = fallback.hook
+	entry.hookTemplate = fallback.hookTemplate
+	entry.username = fallback.username
+	entry.password = fallback.password
+	entry.authSecret = ""
+	entry.token = ""
+	entry.routingKey = ""
+	entry.appriseURLs = ""
+	entry.fallbackHook = ""
+	applyHookBase(&entry)
+	return entry, nil
+}
+
+// withFallback calls the given function to deliver to the hook of the
+// given entry, and again to its fallback hook if that fails.
+func withFallback(entry RSSEntry, send func(RSSEntry) error) error {
+	err := send(entry)
+	if err == nil || entry.fallbackHook == "" {
+		return err
+	}
+
+	fallback, ferr := fallbackEntry(entry)
+	if ferr != nil {
+		fmt.Printf("notify: Invalid fallback hook %s - %s\n", redactCredentials(entry.fallbackHook), ferr.Error())
+		return err
+	}
+	fmt.Printf("notify: Delivery to %s failed, trying the fallback hook %s\n",
+		entry.hook, fallback.hook)
+	return send(fallback)
+}
@@ -0,0 +1,97 @@
+// fetcherror.go contains the error returned when a feed can't be read,
+// which describes the way in which reading it failed.
+//
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+)
+
+// The kinds of failure described by a FetchError.
+const (
+	// FetchRequest means the request couldn't be made, for example
+	// because the URL of the feed is malformed.
+	FetchRequest = "request"
+
+	// FetchDNS means the host of the feed couldn't be resolved.
+	FetchDNS = "dns"
+
+	// FetchTimeout means the request to the feed timed out.
+	FetchTimeout = "timeout"
+
+	// FetchConnect means the host of the feed couldn't be reached,
+	// or the connection failed.
+	FetchConnect = "connect"
+
+	// FetchStatus means the feed returned an unexpected status-code.
+	FetchStatus = "status"
+
+	// FetchContentType means the feed returned content of a type which
+	// isn't accepted, such as an HTML page.
+	FetchContentType = "content-type"
+
+	// FetchFile means the file of a local feed couldn't be read.
+	FetchFile = "file"
+
+	// FetchParse means the content of the feed couldn't be parsed.
+	FetchParse = "parse"
+)
+
+// FetchError is returned when a feed can't be fetched, or parsed.
+type FetchError struct {
+	// Kind is the kind of failure, one of the Fetch* constants.
+	Kind string
+
+	// StatusCode is the status-code returned by the feed, if any.
+	StatusCode int
+
+	// URL is the URL of the feed.
+	URL string
+
+	// Err is the underlying error, if any.
+	Err error
+}
+
+// Error returns a description of the failure.
+func (e *FetchError) Error() string {
+	switch e.Kind {
+	case FetchStatus:
+		return fmt.Sprintf("unexpected status-code %d", e.StatusCode)
+	case FetchParse:
+		return fmt.Sprintf("failed to parse: %s", e.Err.Error())
+	case FetchFile:
+		return fmt.Sprintf("failed to read: %s", e.Err.Error())
+	}
+	return fmt.Sprintf("failed to fetch (%s): %s", e.Kind, e.Err.Error())
+}
+
+// Unwrap returns the underlying error.
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// requestError returns a FetchError describing the given error, which
+// was returned when requesting the given feed.
+func requestError(feed string, err error) *FetchError {
+	kind := FetchConnect
+
+	if u, ok := err.(*url.Error); ok {
+		if u.Timeout() {
+			kind = FetchTimeout
+		}
+		err = u.Err
+	}
+	if op, ok := err.(*net.OpError); ok {
+		if _, ok := op.Err.(*net.DNSError); ok {
+			kind = FetchDNS
+		}
+	}
+	if _, ok := err.(*net.DNSError); ok {
+		kind = FetchDNS
+	}
+
+	return &FetchError{Kind: kind, URL: feed, Err: err}
+}
@@ -0,0 +1,77 @@
+// fields.go contains the code which limits the fields of the JSON object
+// posted to a hook, for receivers which need only a few of them:
+//
+//    https://example.com/feed.rss = https://example.com/hook
+//     - fields: title,link,published,guid
+//
+// Fields are named as they appear in the JSON object, and include those
+// computed from the item, such as domain.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// parseFields parses a comma-separated list of field names.
+func parseFields(list string) map[string]bool {
+	fields := make(map[string]bool)
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field != "" {
+			fields[field] = true
+		}
+	}
+	return fields
+}
+
+// trimObject removes every field which the given entry doesn't allow
+// from the given object.
+func trimObject(entry RSSEntry, object map[string]interface{}) {
+	for key := range object {
+		if !entry.fields[key] {
+			delete(object, key)
+		}
+	}
+}
+
+// trimPayload returns the given JSON payload of a single item, with
+// only the fields allowed by the given entry.
+func trimPayload(entry RSSEntry, jsonValue []byte) ([]byte, error) {
+	if len(entry.fields) == 0 {
+		return jsonValue, nil
+	}
+
+	var object map[string]interface{}
+	err := json.Unmarshal(jsonValue, &object)
+	if err != nil {
+		return nil, err
+	}
+	trimObject(entry, object)
+	return json.Marshal(object)
+}
+
+// trimBatch returns the given JSON batch, with only the fields allowed
+// by the given entry in each of its items.
+//
+// The metadata of the feed is unchanged.
+func trimBatch(entry RSSEntry, jsonValue []byte) ([]byte, error) {
+	if len(entry.fields) == 0 {
+		return jsonValue, nil
+	}
+
+	var batch struct {
+		Feed  json.RawMessage          `json:"feed"`
+		Items []map[string]interface{} `json:"items"`
+	}
+	err := json.Unmarshal(jsonValue, &batch)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range batch.Items {
+		trimObject(entry, item)
+	}
+	return json.Marshal(batch)
+}
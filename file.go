@@ -0,0 +1,134 @@
+// file.go contains the code which reads feeds from the local filesystem,
+// rather than fetching them via HTTP, for feeds which are delivered as
+// files by another process, such as on a shared volume:
+//
+//    file:///srv/feeds/*.rss = https://example.com/hook
+//
+// The path may be a glob, in which case the items of every matching file
+// are treated as those of a single feed.  Only files beneath the root
+// given with -file-root may be read, and none may be unless it is set.
+//
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// FileRoot is the directory beneath which local feeds may be read; none
+// may be read if it is empty.
+var FileRoot string
+
+// isFileFeed returns true if the given feed is a local file.
+func isFileFeed(feed string) bool {
+	return strings.HasPrefix(feed, "file://")
+}
+
+// withinRoot returns an error unless the given path, once any symbolic
+// links are resolved, is beneath FileRoot.
+func withinRoot(path string) error {
+	if FileRoot == "" {
+		return fmt.Errorf("local feeds may only be read when -file-root is set")
+	}
+	root, err := filepath.Abs(FileRoot)
+	if err == nil {
+		root, err = filepath.EvalSymlinks(root)
+	}
+	if err != nil {
+		return err
+	}
+
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(root, real)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s is outside of %s", path, FileRoot)
+	}
+	return nil
+}
+
+// readFileFeed reads, and parses, the local feed of the given entry.
+//
+// Files which can't be parsed, perhaps as they're still being written,
+// are skipped, unless none can be.  Any error returned is a *FetchError.
+func readFileFeed(entry RSSEntry) (*gofeed.Feed, error) {
+	u, err := url.Parse(entry.feed)
+	if err != nil {
+		return nil, &FetchError{Kind: FetchRequest, URL: entry.feed, Err: err}
+	}
+	if !filepath.IsAbs(u.Path) {
+		return nil, &FetchError{Kind: FetchRequest, URL: entry.feed, Err: fmt.Errorf("the path must be absolute")}
+	}
+	matches, err := filepath.Glob(u.Path)
+	if err != nil {
+		return nil, &FetchError{Kind: FetchRequest, URL: entry.feed, Err: err}
+	}
+
+	// A glob matching nothing is an empty feed, but a missing file is
+	// an error.
+	if len(matches) == 0 && !strings.ContainsAny(u.Path, "*?[") {
+		return nil, &FetchError{Kind: FetchFile, URL: entry.feed, Err: fmt.Errorf("%s does not exist", u.Path)}
+	}
+
+	merged := &gofeed.Feed{}
+	parsed := 0
+	var parseErr error
+	for _, path := range matches {
+		err = withinRoot(path)
+		if err != nil {
+			return nil, &FetchError{Kind: FetchRequest, URL: entry.feed, Err: err}
+		}
+
+		feed, err := parseFile(entry, path)
+		if fe, ok := err.(*FetchError); ok && fe.Kind == FetchParse {
+			fmt.Printf("Skipping %s - %s\n", path, err.Error())
+			parseErr = err
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if parsed == 0 {
+			*merged = *feed
+			merged.Items = nil
+		}
+		merged.Items = append(merged.Items, feed.Items...)
+		parsed++
+	}
+
+	if parsed == 0 && parseErr != nil {
+		return nil, parseErr
+	}
+	return merged, nil
+}
+
+// parseFile reads, and parses, the given file of the local feed of the
+// given entry.
+func parseFile(entry RSSEntry, path string) (*gofeed.Feed, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, &FetchError{Kind: FetchFile, URL: entry.feed, Err: err}
+	}
+
+	body, err := decodeFeed(entry, "", file)
+	if err != nil {
+		file.Close()
+		return nil, &FetchError{Kind: FetchParse, URL: entry.feed, Err: err}
+	}
+	defer body.Close()
+
+	feed, err := gofeed.NewParser().Parse(body)
+	if err != nil {
+		return nil, &FetchError{Kind: FetchParse, URL: entry.feed, Err: err}
+	}
+	return feed, nil
+}
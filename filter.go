@@ -0,0 +1,139 @@
+// filter.go contains the code which decides whether a new feed-item
+// should be notified, or merely recorded as seen.
+//
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// DeniedDomains contains the domains whose items are never notified,
+// regardless of the feed they appear in.
+var DeniedDomains []string
+
+// parseDomains splits a comma-separated list of domains.
+func parseDomains(list string) []string {
+	var domains []string
+	for _, domain := range strings.Split(list, ",") {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
+// domainMatches returns true if the host matches the given pattern.
+//
+// A pattern of the form "*.example.com" matches "example.com" and all
+// of its subdomains, otherwise the host must match exactly.
+func domainMatches(host string, pattern string) bool {
+	if strings.HasPrefix(pattern, "*.") {
+		parent := pattern[2:]
+		return host == parent || strings.HasSuffix(host, "."+parent)
+	}
+	return host == pattern
+}
+
+// domainDenied returns true if the link of the given item points to a
+// domain which is denied, either globally or for the given feed.
+func domainDenied(entry RSSEntry, item *gofeed.Item) bool {
+	u, err := url.Parse(item.Link)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+
+	for _, pattern := range DeniedDomains {
+		if domainMatches(host, pattern) {
+			return true
+		}
+	}
+	for _, pattern := range entry.deniedDomains {
+		if domainMatches(host, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// foreignDomain returns true if the given entry only notifies items on
+// the domain of its feed, and the link of the given item points to a
+// different domain.
+//
+// The link may point to the host of the feed, or any of its subdomains,
+// with any "www." prefix of the feed's host ignored.  Relative links
+// are always on the same domain.
+func foreignDomain(entry RSSEntry, item *gofeed.Item) bool {
+	if !entry.sameDomainOnly || item.Link == "" {
+		return false
+	}
+
+	f, err := url.Parse(entry.feed)
+	if err != nil || f.Hostname() == "" {
+		return false
+	}
+	feedHost := strings.TrimPrefix(strings.ToLower(f.Hostname()), "www.")
+
+	u, err := url.Parse(item.Link)
+	if err != nil {
+		return true
+	}
+	host := strings.ToLower(u.Hostname())
+	return host != "" && !domainMatches(host, "*."+feedHost)
+}
+
+// filterText returns the text of the given item which the include, and
+// exclude, patterns are matched against; its title and description.
+func filterText(item *gofeed.Item) string {
+	return item.Title + "\n" + plainText(item.Description)
+}
+
+// checkFilters returns true if the given item should be notified,
+// along with the reason why, or why not.
+//
+// Items linking to denied domains, or to other domains than the feed's
+// if it only notifies those on its own, or matching an exclude pattern,
+// are never notified, nor are items without links if the feed's policy is
+// to skip them, or which fail the feed's expression.  If the feed has
+// include patterns then items must match one of them.
+func checkFilters(entry RSSEntry, item *gofeed.Item) (bool, string) {
+	if item.Link == "" && entry.missingLink == "skip" {
+		return false, "no link"
+	}
+	if domainDenied(entry, item) {
+		return false, "denied domain"
+	}
+	if foreignDomain(entry, item) {
+		return false, "not on the feed's domain"
+	}
+
+	text := filterText(item)
+	for _, re := range entry.exclude {
+		if re.MatchString(text) {
+			return false, fmt.Sprintf("matches exclude /%s/", re.String())
+		}
+	}
+
+	if entry.expression != nil && !entry.expression.eval(item) {
+		return false, fmt.Sprintf("fails expression %s", entry.expression.source)
+	}
+
+	if len(entry.include) == 0 && entry.expression != nil {
+		return true, "satisfies expression"
+	}
+	if len(entry.include) == 0 {
+		return true, "no include patterns"
+	}
+	for _, re := range entry.include {
+		if re.MatchString(text) {
+			return true, fmt.Sprintf("matches include /%s/", re.String())
+		}
+	}
+	return false, "matches no include pattern"
+}
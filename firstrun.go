@@ -0,0 +1,138 @@
+// firstrun.go contains the code which decides which items are notified
+// the first time a feed is polled, when every item it contains is new.
+//
+// The policy is one of:
+//
+//    all       - notify every item, the default.
+//    seed      - notify nothing, recording every item as seen.
+//    latest:N  - notify the N newest items, recording the rest as seen.
+//
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// FirstRun is the policy applied to the items of a feed the first time
+// it is polled.
+var FirstRun = "all"
+
+// FirstRunLatest is the number of items notified, if the policy is
+// "latest:N".
+var FirstRunLatest int
+
+// setupFirstRun parses the given first-run policy.
+func setupFirstRun(policy string) error {
+	switch {
+	case policy == "all" || policy == "seed":
+		FirstRun = policy
+		return nil
+	case strings.HasPrefix(policy, "latest:"):
+		n, err := strconv.Atoi(strings.TrimPrefix(policy, "latest:"))
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid count in %s", policy)
+		}
+		FirstRun = "latest"
+		FirstRunLatest = n
+		return nil
+	}
+	return fmt.Errorf("unknown policy %s, expected all, seed, or latest:N", policy)
+}
+
+// firstRun returns true if the given items are those of the first poll
+// of the feed of the given entry.
+//
+// A feed which was polled before first-run policies were recorded is
+// recognised by having items which were already seen, or seen-keys or
+// links recorded, and has its first poll recorded now so that a later
+// poll in which every item is new isn't mistaken for the first.
+func firstRun(entry RSSEntry, items []*gofeed.Item) bool {
+	parent := seenParent(entry)
+	state := loadFeedState(parent)
+	if !state.FirstPoll.IsZero() {
+		return false
+	}
+
+	polled := len(state.SeenKeys) > 0 || len(loadFeedState(entry.feed).Links) > 0
+	for _, i := range items {
+		if !isNew(entry, i) {
+			polled = true
+			break
+		}
+	}
+	if !polled {
+		return true
+	}
+
+	state.FirstPoll = time.Now()
+	err := saveFeedState(parent, state)
+	if err != nil {
+		fmt.Printf("Error saving state of %s - %s\n", redactCredentials(parent), err.Error())
+	}
+	return false
+}
+
+// latestItems returns the given number of the newest of the given
+// items.
+//
+// If any item lacks a timestamp the feed is assumed to list its newest
+// items first.
+func latestItems(entry RSSEntry, items []*gofeed.Item, n int) []*gofeed.Item {
+	sorted := items
+	if allTimed(entry, items) {
+		sorted = make([]*gofeed.Item, len(items))
+		copy(sorted, items)
+		sort.SliceStable(sorted, func(a, b int) bool {
+			return itemTime(entry, sorted[a]).After(*itemTime(entry, sorted[b]))
+		})
+	}
+
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+// applyFirstRun applies the first-run policy to the given items, of the
+// first poll of the feed of the given entry, recording those which won't
+// be notified as seen.
+//
+// The items which should be notified are returned, in their original
+// order.
+func applyFirstRun(entry RSSEntry, items []*gofeed.Item) []*gofeed.Item {
+	parent := seenParent(entry)
+	state := loadFeedState(parent)
+	state.FirstPoll = time.Now()
+	err := saveFeedState(parent, state)
+	if err != nil {
+		fmt.Printf("Error saving state of %s - %s\n", redactCredentials(parent), err.Error())
+	}
+
+	keep := make(map[*gofeed.Item]bool)
+	switch FirstRun {
+	case "all":
+		return items
+	case "latest":
+		for _, i := range latestItems(entry, items, FirstRunLatest) {
+			keep[i] = true
+		}
+	}
+
+	var notify []*gofeed.Item
+	for _, i := range items {
+		if keep[i] {
+			notify = append(notify, i)
+			continue
+		}
+		debug("Seeding %s - first poll of %s\n", itemName(i), redactCredentials(entry.feed))
+		recordSeen(entry, i)
+	}
+	return notify
+}
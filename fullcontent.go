@@ -0,0 +1,87 @@
+// fullcontent.go contains the code which fetches the article an item
+// links to, and extracts its body, for feeds which only publish
+// summaries.
+//
+// This is heavy, so it must be enabled for each feed which needs it.
+//
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// fetchFullContent fetches the page at the given link, and returns the
+// text of the article it contains, as paragraphs separated by blank
+// lines.
+//
+// Any error is returned to the caller, which should fall back to the
+// summary of the item.
+func fetchFullContent(link string) (string, error) {
+
+	req, err := http.NewRequest("GET", link, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "rss2email (https://github.com/skx/rss2email)")
+
+	resp, err := FetchClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("unexpected status-code %d", resp.StatusCode)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	text := extractArticle(doc)
+	if text == "" {
+		return "", fmt.Errorf("no article found")
+	}
+	return text, nil
+}
+
+// extractArticle returns the text of the article within the given
+// document.
+//
+// Elements which are never part of an article are discarded, then the
+// element whose paragraphs contain the most text is taken to be the
+// article.
+func extractArticle(doc *goquery.Document) string {
+	doc.Find("script, style, noscript, nav, header, footer, aside, form").Remove()
+
+	var best *goquery.Selection
+	bestScore := 0
+
+	doc.Find("p").Parent().Each(func(_ int, s *goquery.Selection) {
+		score := 0
+		s.ChildrenFiltered("p").Each(func(_ int, p *goquery.Selection) {
+			score += len(strings.TrimSpace(p.Text()))
+		})
+		if score > bestScore {
+			best, bestScore = s, score
+		}
+	})
+	if best == nil {
+		return ""
+	}
+
+	var paragraphs []string
+	best.ChildrenFiltered("p").Each(func(_ int, p *goquery.Selection) {
+		text := strings.Join(strings.Fields(p.Text()), " ")
+		if text != "" {
+			paragraphs = append(paragraphs, text)
+		}
+	})
+	return strings.Join(paragraphs, "\n\n")
+}
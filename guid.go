@@ -0,0 +1,118 @@
+// guid.go contains the code which deals with feeds whose GUIDs are
+// unreliable.
+//
+// Some feeds use links containing tracking parameters as their GUIDs,
+// which vary over time, so the GUIDs of such feeds may be normalized.
+//
+// If a feed switches from, for example, using permalinks as GUIDs to
+// using random values then every item appears new, and is notified
+// again.  Such feeds should be identified by their links instead.
+//
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// isURL returns true if the given GUID is an absolute HTTP(S) URL.
+func isURL(guid string) bool {
+	u, err := url.Parse(guid)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// normalizeGUID returns the given GUID with any tracking parameters
+// removed, if it is a URL.  Other GUIDs are returned unchanged.
+func normalizeGUID(guid string) string {
+	if !isURL(guid) {
+		return guid
+	}
+	u, _ := url.Parse(guid)
+
+	query := u.Query()
+	for name := range query {
+		if strings.HasPrefix(strings.ToLower(name), "utm_") {
+			query.Del(name)
+		}
+	}
+	u.RawQuery = query.Encode()
+	u.Fragment = ""
+	return u.String()
+}
+
+// fixLinks applies the missing-link policy of the given entry to those
+// of the given items which have no link.
+//
+// If the policy is "use-guid-as-link" their GUIDs are used as their
+// links, providing they're URLs.  Other policies are applied as items
+// are filtered, see checkFilters.
+func fixLinks(entry RSSEntry, items []*gofeed.Item) {
+	if entry.missingLink != "use-guid-as-link" {
+		return
+	}
+
+	for _, i := range items {
+		if i.Link == "" && isURL(i.GUID) {
+			debug("Using GUID as the link of %s\n", i.GUID)
+			i.Link = i.GUID
+		}
+	}
+}
+
+// checkGUIDs warns if the given items, just fetched from the feed of
+// the given entry, suggest the feed has changed its GUIDs.
+//
+// That is the case if most of the items appear to be new, yet their
+// links belonged to items which had been seen when the feed was last
+// polled.  The warning is purely advisory.
+func checkGUIDs(entry RSSEntry, items []*gofeed.Item) {
+
+	// Items identified by their links are unaffected.
+	if entry.dedup == "link" {
+		return
+	}
+
+	previous := make(map[string]bool)
+	for _, link := range loadFeedState(entry.feed).Links {
+		previous[link] = true
+	}
+
+	changed := 0
+	for _, i := range items {
+		if i.Link != "" && previous[i.Link] && isNew(entry, i) {
+			changed++
+		}
+	}
+
+	if len(items) > 0 && changed > len(items)/2 {
+		fmt.Printf("WARNING: %d of the %d items of %s appear new, but were seen when it was last polled.\n",
+			changed, len(items), redactCredentials(entry.feed))
+		fmt.Printf("WARNING: the feed may have changed its GUIDs, consider adding '- dedup: link' to its entry.\n")
+	}
+}
+
+// rememberLinks records the links of the given items which have been
+// seen, for checkGUIDs to consult when the feed is next polled.
+func rememberLinks(entry RSSEntry, items []*gofeed.Item) {
+	if entry.dedup == "link" {
+		return
+	}
+
+	var links []string
+	for _, i := range items {
+		if i.Link != "" && !isNew(entry, i) {
+			links = append(links, i.Link)
+		}
+	}
+
+	state := loadFeedState(entry.feed)
+	state.Links = links
+	err := saveFeedState(entry.feed, state)
+	if err != nil {
+		fmt.Printf("Error saving state of %s - %s\n", redactCredentials(entry.feed), err.Error())
+	}
+}
@@ -0,0 +1,76 @@
+// hook_apprise.go contains the code for sending feed-items to an Apprise
+// API server, which relays them to any of the many services Apprise
+// supports, see https://github.com/caronc/apprise-api for details.
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// appriseBodyLength is the maximum length of the description we include
+// in an Apprise notification.
+const appriseBodyLength = 1000
+
+// appriseMessage is the message we submit to Apprise.
+type appriseMessage struct {
+	URLs  string `json:"urls,omitempty"`
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	Type  string `json:"type"`
+}
+
+// appriseType returns the type of the notification of an item with the
+// given priority, which Apprise may use to style it.
+func appriseType(priority int) string {
+	if priority >= 4 {
+		return "warning"
+	}
+	return "info"
+}
+
+// notifyApprise sends the given item to the Apprise API endpoint which
+// is the hook of the given entry.
+//
+// The endpoint is either `/notify`, in which case the services to notify
+// are given by the apprise-urls option, or `/notify/<key>` to notify the
+// services stored by the server under that key.
+func notifyApprise(entry RSSEntry, item *gofeed.Item, priority int) error {
+
+	text := truncate(plainText(item.Description), appriseBodyLength)
+	if item.Link != "" {
+		text = strings.TrimSpace(text + "\n\n" + item.Link)
+	}
+	title := strings.TrimSpace(item.Title)
+	if title == "" {
+		title = itemName(item)
+	}
+
+	body, err := json.Marshal(appriseMessage{
+		URLs:  entry.appriseURLs,
+		Title: title,
+		Body:  text,
+		Type:  appriseType(priority),
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", entry.hook, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	err = setHookAuth(entry, req)
+	if err != nil {
+		return err
+	}
+
+	return deliver(entry, req, acceptStatus(entry))
+}
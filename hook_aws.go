@@ -0,0 +1,119 @@
+// hook_aws.go contains the code for publishing feed-items to AWS,
+// via either an SNS topic or an SQS queue.
+//
+// Credentials are found via the standard AWS credential chain.
+//
+
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// awsRetries is the number of times the SDK will retry a failed, or
+// throttled, request before giving up.
+const awsRetries = 5
+
+// awsCache holds the AWS sessions we've created, keyed by region,
+// and the URLs of the SQS queues we've looked up, keyed by ARN.
+var awsCache = struct {
+	sync.Mutex
+	sessions map[string]*session.Session
+	queues   map[string]string
+}{
+	sessions: make(map[string]*session.Session),
+	queues:   make(map[string]string),
+}
+
+// isAWSHook returns true if the given hook is the ARN of an SNS topic,
+// or an SQS queue.
+func isAWSHook(hook string) bool {
+	return strings.HasPrefix(hook, "arn:aws:sns:") ||
+		strings.HasPrefix(hook, "arn:aws:sqs:")
+}
+
+// awsSession returns a session for the given region, creating it if
+// required.
+func awsSession(region string) (*session.Session, error) {
+	awsCache.Lock()
+	defer awsCache.Unlock()
+
+	if sess, ok := awsCache.sessions[region]; ok {
+		return sess, nil
+	}
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:     aws.String(region),
+		MaxRetries: aws.Int(awsRetries),
+		HTTPClient: HookClient,
+	})
+	if err != nil {
+		return nil, err
+	}
+	awsCache.sessions[region] = sess
+	return sess, nil
+}
+
+// sqsQueueURL returns the URL of the SQS queue with the given ARN.
+func sqsQueueURL(svc *sqs.SQS, queue arn.ARN) (string, error) {
+	awsCache.Lock()
+	defer awsCache.Unlock()
+
+	if url, ok := awsCache.queues[queue.String()]; ok {
+		return url, nil
+	}
+
+	out, err := svc.GetQueueUrl(&sqs.GetQueueUrlInput{
+		QueueName:              aws.String(queue.Resource),
+		QueueOwnerAWSAccountId: aws.String(queue.AccountID),
+	})
+	if err != nil {
+		return "", err
+	}
+	awsCache.queues[queue.String()] = *out.QueueUrl
+	return *out.QueueUrl, nil
+}
+
+// notifyAWS publishes the given message to the SNS topic, or SQS queue,
+// with the specified ARN.
+//
+// Each item is sent individually, rather than batched, so that an item
+// is only recorded as seen once it has itself been delivered.
+func notifyAWS(hook string, message []byte) error {
+
+	target, err := arn.Parse(hook)
+	if err != nil {
+		return err
+	}
+
+	sess, err := awsSession(target.Region)
+	if err != nil {
+		return err
+	}
+
+	if target.Service == "sns" {
+		_, err = sns.New(sess).Publish(&sns.PublishInput{
+			TopicArn: aws.String(hook),
+			Message:  aws.String(string(message)),
+		})
+		return err
+	}
+
+	svc := sqs.New(sess)
+	url, err := sqsQueueURL(svc, target)
+	if err != nil {
+		return err
+	}
+	_, err = svc.SendMessage(&sqs.SendMessageInput{
+		QueueUrl:    aws.String(url),
+		MessageBody: aws.String(string(message)),
+	})
+	return err
+}
@@ -0,0 +1,82 @@
+// hook_gotify.go contains the code for sending feed-items to a Gotify
+// server, see https://gotify.net/ for details.
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// gotifyMessageLength is the maximum length of the description we
+// include in a Gotify message.
+const gotifyMessageLength = 500
+
+// gotifyPriorities maps our priorities to those used by Gotify.
+var gotifyPriorities = map[int]int{1: 1, 2: 3, 3: 5, 4: 7, 5: 10}
+
+// gotifyMessage is the message we submit to Gotify.
+type gotifyMessage struct {
+	Title    string `json:"title"`
+	Message  string `json:"message"`
+	Priority int    `json:"priority,omitempty"`
+}
+
+// gotifyError is the body returned by Gotify when it rejects a message.
+type gotifyError struct {
+	Error            string `json:"error"`
+	ErrorCode        int    `json:"errorCode"`
+	ErrorDescription string `json:"errorDescription"`
+}
+
+// notifyGotify sends the given item, with the given priority, to the
+// Gotify server which is the hook of the given entry.
+func notifyGotify(entry RSSEntry, item *gofeed.Item, priority int) error {
+
+	message := truncate(plainText(item.Description), gotifyMessageLength)
+	if item.Link != "" {
+		message = strings.TrimSpace(message + "\n\n" + item.Link)
+	}
+
+	body, err := json.Marshal(gotifyMessage{
+		Title:    item.Title,
+		Message:  message,
+		Priority: gotifyPriorities[priority],
+	})
+	if err != nil {
+		return err
+	}
+
+	url := strings.TrimSuffix(entry.hook, "/") + "/message"
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", entry.token)
+	err = setHookAuth(entry, req)
+	if err != nil {
+		return err
+	}
+
+	return deliver(entry, req, checkGotify)
+}
+
+// checkGotify returns an error if Gotify rejected our message.
+func checkGotify(status int, body []byte) error {
+	if status >= 200 && status < 300 {
+		return nil
+	}
+
+	var reply gotifyError
+	if json.Unmarshal(body, &reply) == nil && reply.Error != "" {
+		return fmt.Errorf("%d %s: %s", reply.ErrorCode, reply.Error, reply.ErrorDescription)
+	}
+	return fmt.Errorf("status code %d", status)
+}
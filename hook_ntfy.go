@@ -0,0 +1,51 @@
+// hook_ntfy.go contains the code for sending feed-items to an ntfy
+// topic, see https://ntfy.sh/ for details.
+//
+
+package main
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// notifyNtfy publishes the given item to the ntfy topic which is the
+// hook of the given entry.
+//
+// The item's description is used as the message, with the title and
+// link being submitted via ntfy's headers, along with the given priority.
+func notifyNtfy(entry RSSEntry, item *gofeed.Item, priority int) error {
+
+	message := plainText(item.Description)
+	if message == "" {
+		message = item.Title
+	}
+
+	req, err := http.NewRequest("POST", entry.hook, strings.NewReader(message))
+	if err != nil {
+		return err
+	}
+
+	// Headers must be ASCII, so encode the title if required.
+	req.Header.Set("Title", mime.QEncoding.Encode("utf-8", item.Title))
+	if item.Link != "" {
+		req.Header.Set("Click", item.Link)
+	}
+	if priority != 0 {
+		req.Header.Set("Priority", strconv.Itoa(priority))
+	}
+	if entry.tags != "" {
+		req.Header.Set("Tags", entry.tags)
+	}
+
+	err = setHookAuth(entry, req)
+	if err != nil {
+		return err
+	}
+
+	return deliver(entry, req, acceptStatus(entry))
+}
@@ -0,0 +1,127 @@
+// hook_pagerduty.go contains the code for triggering PagerDuty alerts,
+// via the Events API v2, for feed-items.
+//
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// pagerDutyEvent is the event we submit to the Events API.
+type pagerDutyEvent struct {
+	RoutingKey  string           `json:"routing_key"`
+	EventAction string           `json:"event_action"`
+	DedupKey    string           `json:"dedup_key,omitempty"`
+	Payload     pagerDutyPayload `json:"payload"`
+	Links       []pagerDutyLink  `json:"links,omitempty"`
+}
+
+// pagerDutyPayload describes the alert of an event.
+type pagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Timestamp     string            `json:"timestamp,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+// pagerDutyLink is a link attached to an event.
+type pagerDutyLink struct {
+	Href string `json:"href"`
+	Text string `json:"text,omitempty"`
+}
+
+// pagerDutyError is the body returned when PagerDuty rejects an event.
+type pagerDutyError struct {
+	Status  string   `json:"status"`
+	Message string   `json:"message"`
+	Errors  []string `json:"errors"`
+}
+
+// pagerDutyDedupKey returns the deduplication key for the given item,
+// so that an item which is delivered twice only raises one incident.
+//
+// The GUID is used directly, unless it exceeds PagerDuty's limit.
+func pagerDutyDedupKey(item *gofeed.Item) string {
+	if item.GUID == "" || len(item.GUID) > 255 {
+		hasher := sha1.New()
+		hasher.Write([]byte(item.GUID + item.Link))
+		return hex.EncodeToString(hasher.Sum(nil))
+	}
+	return item.GUID
+}
+
+// notifyPagerDuty triggers a PagerDuty alert for the given item.
+func notifyPagerDuty(entry RSSEntry, item *gofeed.Item) error {
+
+	severity := entry.severity
+	if severity == "" {
+		severity = "info"
+	}
+
+	event := pagerDutyEvent{
+		RoutingKey:  entry.routingKey,
+		EventAction: "trigger",
+		DedupKey:    pagerDutyDedupKey(item),
+		Payload: pagerDutyPayload{
+			Summary:  truncate(item.Title, 1000),
+			Source:   redactCredentials(entry.feed),
+			Severity: severity,
+			CustomDetails: map[string]string{
+				"description": plainText(item.Description),
+				"link":        item.Link,
+			},
+		},
+	}
+	if published := itemTime(entry, item); published != nil {
+		event.Payload.Timestamp = published.UTC().Format("2006-01-02T15:04:05Z")
+	}
+	if item.Link != "" {
+		event.Links = []pagerDutyLink{{Href: item.Link, Text: item.Title}}
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", entry.hook, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	err = setHookAuth(entry, req)
+	if err != nil {
+		return err
+	}
+
+	return deliver(entry, req, checkPagerDuty)
+}
+
+// checkPagerDuty returns an error if PagerDuty did not accept our event.
+//
+// A rate-limited event is treated as a failure, so that it'll be retried
+// upon the next poll.
+func checkPagerDuty(status int, body []byte) error {
+	if status >= 200 && status < 300 {
+		return nil
+	}
+	if status == http.StatusTooManyRequests {
+		return fmt.Errorf("rate-limited, will retry")
+	}
+
+	var reply pagerDutyError
+	if json.Unmarshal(body, &reply) == nil && reply.Message != "" {
+		return fmt.Errorf("%d %s: %s", status, reply.Message, strings.Join(reply.Errors, ", "))
+	}
+	return fmt.Errorf("status code %d", status)
+}
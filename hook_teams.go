@@ -0,0 +1,150 @@
+// hook_teams.go contains the code for sending feed-items to a Microsoft
+// Teams channel, via an incoming webhook, as Adaptive Cards.
+//
+// See https://adaptivecards.io/ for details of the card format.
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// teamsTextLength is the maximum length of the description we include
+// in a card; Teams rejects messages larger than 28KB.
+const teamsTextLength = 1000
+
+// teamsMarkdown matches the characters which are significant within the
+// markdown supported by Adaptive Cards.
+var teamsMarkdown = strings.NewReplacer(
+	`\`, `\\`, `[`, `\[`, `]`, `\]`, `*`, `\*`, `_`, `\_`,
+)
+
+// teamsElement is an element, or action, of an Adaptive Card.
+type teamsElement struct {
+	Type   string `json:"type"`
+	Text   string `json:"text,omitempty"`
+	Weight string `json:"weight,omitempty"`
+	Size   string `json:"size,omitempty"`
+	Wrap   bool   `json:"wrap,omitempty"`
+	Title  string `json:"title,omitempty"`
+	URL    string `json:"url,omitempty"`
+}
+
+// teamsCard is an Adaptive Card.
+type teamsCard struct {
+	Schema  string         `json:"$schema"`
+	Type    string         `json:"type"`
+	Version string         `json:"version"`
+	Body    []teamsElement `json:"body"`
+	Actions []teamsElement `json:"actions,omitempty"`
+}
+
+// teamsAttachment is an attachment of a Teams message.
+type teamsAttachment struct {
+	ContentType string    `json:"contentType"`
+	Content     teamsCard `json:"content"`
+}
+
+// teamsMessage is the message we submit to Teams.
+type teamsMessage struct {
+	Type        string            `json:"type"`
+	Attachments []teamsAttachment `json:"attachments"`
+}
+
+// newTeamsCard creates the card for the given item.
+//
+// Teams rejects cards containing empty text, or actions without a URL,
+// so these are omitted.
+func newTeamsCard(item *gofeed.Item) teamsCard {
+	title := strings.TrimSpace(item.Title)
+	if title == "" {
+		title = itemName(item)
+	}
+	title = teamsMarkdown.Replace(title)
+	if item.Link != "" {
+		link := strings.NewReplacer("(", "%28", ")", "%29").Replace(item.Link)
+		title = "[" + title + "](" + link + ")"
+	}
+
+	card := teamsCard{
+		Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+		Type:    "AdaptiveCard",
+		Version: "1.2",
+		Body: []teamsElement{
+			{Type: "TextBlock", Text: title, Weight: "Bolder", Size: "Medium", Wrap: true},
+		},
+	}
+
+	text := truncate(plainText(item.Description), teamsTextLength)
+	if text != "" {
+		card.Body = append(card.Body, teamsElement{
+			Type: "TextBlock", Text: teamsMarkdown.Replace(text), Wrap: true,
+		})
+	}
+	if item.Link != "" {
+		card.Actions = []teamsElement{
+			{Type: "Action.OpenUrl", Title: "Read more", URL: item.Link},
+		}
+	}
+	return card
+}
+
+// notifyTeams sends the given item to the Teams incoming webhook which
+// is the hook of the given entry.
+func notifyTeams(entry RSSEntry, item *gofeed.Item) error {
+
+	body, err := json.Marshal(teamsMessage{
+		Type: "message",
+		Attachments: []teamsAttachment{
+			{
+				ContentType: "application/vnd.microsoft.card.adaptive",
+				Content:     newTeamsCard(item),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", entry.hook, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	err = setHookAuth(entry, req)
+	if err != nil {
+		return err
+	}
+
+	return deliver(entry, req, checkTeams)
+}
+
+// checkTeams returns an error if Teams did not accept our message.
+//
+// Teams may report errors, including rate-limiting, within the body of
+// a response whose status is 200.  A rate-limited message is treated as
+// a failure, so that it'll be retried upon the next poll.
+func checkTeams(status int, body []byte) error {
+	reply := strings.TrimSpace(string(body))
+
+	if status == http.StatusTooManyRequests || strings.Contains(reply, "HTTP error 429") {
+		return fmt.Errorf("rate-limited, will retry")
+	}
+	if status < 200 || status > 299 {
+		if reply != "" {
+			return fmt.Errorf("status code %d: %s", status, reply)
+		}
+		return fmt.Errorf("status code %d", status)
+	}
+	if strings.Contains(reply, "returned HTTP error") {
+		return fmt.Errorf("%s", reply)
+	}
+	return nil
+}
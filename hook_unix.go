@@ -0,0 +1,97 @@
+// hook_unix.go contains the code for delivering to webhooks which
+// listen upon a Unix domain socket, rather than a TCP port.
+//
+// Such hooks are written as the path of the socket, followed by the
+// path of the HTTP request, for example:
+//
+//    unix:///run/hook.sock:/path
+//
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// unixTransport is registered for the "unix" scheme with the transport
+// of our hook client, and delivers requests via the socket they name.
+type unixTransport struct {
+	sync.Mutex
+
+	// transports caches a transport for each socket, so connections
+	// to it are kept alive and reused.
+	transports map[string]*http.Transport
+}
+
+// isUnixHook returns true if the given hook is that of a Unix domain
+// socket.
+func isUnixHook(hook string) bool {
+	return strings.HasPrefix(hook, "unix://")
+}
+
+// splitUnixHook splits the path of a unix-hook into the path of the
+// socket, and the path of the HTTP request.
+func splitUnixHook(path string) (string, string, error) {
+	i := strings.Index(path, ":")
+	if i < 0 {
+		return path, "/", nil
+	}
+	if i == 0 {
+		return "", "", fmt.Errorf("missing socket in unix hook")
+	}
+
+	socket, request := path[:i], path[i+1:]
+	if !strings.HasPrefix(request, "/") {
+		request = "/" + request
+	}
+	return socket, request, nil
+}
+
+// transport returns the transport used to deliver via the given socket.
+func (u *unixTransport) transport(socket string) *http.Transport {
+	u.Lock()
+	defer u.Unlock()
+
+	if u.transports == nil {
+		u.transports = make(map[string]*http.Transport)
+	}
+	t, ok := u.transports[socket]
+	if !ok {
+		t = newTransport(false)
+		t.Proxy = nil
+		t.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			d := net.Dialer{Timeout: 30 * time.Second}
+			return d.DialContext(ctx, "unix", socket)
+		}
+		u.transports[socket] = t
+	}
+	return t
+}
+
+// RoundTrip delivers the request via the socket named in its URL.
+func (u *unixTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	socket, path, err := splitUnixHook(req.URL.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send a normal HTTP request, over the socket.
+	out := new(http.Request)
+	*out = *req
+	out.URL = new(url.URL)
+	*out.URL = *req.URL
+	out.URL.Scheme = "http"
+	out.URL.Host = "localhost"
+	out.URL.Path = path
+	out.URL.RawPath = ""
+	out.Host = "localhost"
+
+	return u.transport(socket).RoundTrip(out)
+}
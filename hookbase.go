@@ -0,0 +1,69 @@
+// hookbase.go contains the code which applies a global prefix, and
+// suffix, to the URL of every hook.
+//
+// This allows all hooks to be routed through a gateway, for example:
+//
+//    rss2hook -hook-base 'https://gw.internal/relay?target='
+//
+
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// HookBase is prepended to the URL of every hook.
+var HookBase string
+
+// HookSuffix is appended to the URL of every hook.
+var HookSuffix string
+
+// hookBaseUsername, and hookBasePassword, are any credentials within
+// HookBase, which are removed from it so that they're never shown.
+var hookBaseUsername, hookBasePassword string
+
+// setupHookBase removes any credentials from HookBase, to be sent to the
+// gateway via HTTP Basic authentication instead.
+func setupHookBase() {
+	HookBase, hookBaseUsername, hookBasePassword = splitCredentials(HookBase)
+}
+
+// withHookBase returns the given hook URL with the global prefix, and
+// suffix, applied.
+//
+// If the prefix ends with "=" the hook becomes the value of a query
+// parameter, so it is URL-escaped.  Otherwise it is appended as-is,
+// typically forming the path of the gateway URL.
+func withHookBase(hook string) string {
+	if HookBase == "" && HookSuffix == "" {
+		return hook
+	}
+
+	if strings.HasSuffix(HookBase, "=") {
+		hook = url.QueryEscape(hook)
+	}
+	return HookBase + hook + HookSuffix
+}
+
+// applyHookBase applies the global prefix, and suffix, to the hook of
+// the given entry, unless the entry has opted out.
+//
+// Templated hooks are left alone here, as they're only complete once
+// rendered for an item, see hookURL, as are those which aren't URLs of
+// HTTP endpoints.
+//
+// Any credentials within the prefix are those of the gateway, to which
+// we then post, so they replace those of the hook.
+func applyHookBase(entry *RSSEntry) {
+	if entry.noHookBase || isAWSHook(entry.hook) || isUnixHook(entry.hook) || entry.hookType == "smtp" {
+		return
+	}
+	if hookBaseUsername != "" || hookBasePassword != "" {
+		entry.username = hookBaseUsername
+		entry.password = hookBasePassword
+	}
+	if entry.hookTemplate == nil {
+		entry.hook = withHookBase(entry.hook)
+	}
+}
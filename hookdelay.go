@@ -0,0 +1,95 @@
+// hookdelay.go contains the code which honours the requests of hooks to
+// slow down, made via a header of their responses.
+//
+// The header, named by -delay-header, may give either the number of
+// seconds to wait, the Unix time at which to resume, or a HTTP date.
+// It is honoured whatever the status of the response, and deliveries to
+// the same host wait until the delay has passed.
+//
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DelayHeader is the name of the header in which hooks may request a
+// delay before their next delivery, if set.
+var DelayHeader string
+
+// maxHookDelay is the longest delay a hook may request; longer delays
+// are shortened, so that a misbehaving hook can't stall us.
+const maxHookDelay = 5 * time.Minute
+
+// hookDelays holds the time before which no delivery should be made to
+// each host which requested a delay.
+var hookDelays = struct {
+	sync.Mutex
+	until map[string]time.Time
+}{until: make(map[string]time.Time)}
+
+// parseDelay returns the delay requested by the given header value, or
+// zero if it couldn't be parsed.
+//
+// Values small enough to be a number of seconds are treated as such,
+// larger numbers are treated as a Unix time.
+func parseDelay(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+
+	if n, err := strconv.ParseFloat(value, 64); err == nil {
+		if n > 1e9 {
+			return time.Unix(int64(n), 0).Sub(now)
+		}
+		return time.Duration(n * float64(time.Second))
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// waitForHook waits until any delay requested by the given host has
+// passed.
+func waitForHook(host string) {
+	hookDelays.Lock()
+	until := hookDelays.until[host]
+	hookDelays.Unlock()
+
+	if wait := time.Until(until); wait > 0 {
+		debug("Waiting %s before delivering to %s\n", wait, host)
+		time.Sleep(wait)
+	}
+}
+
+// recordHookDelay records any delay requested by the given response,
+// from the given host.
+func recordHookDelay(host string, res *http.Response) {
+	if DelayHeader == "" {
+		return
+	}
+	value := res.Header.Get(DelayHeader)
+	if value == "" {
+		return
+	}
+
+	now := time.Now()
+	delay := parseDelay(value, now)
+	if delay <= 0 {
+		return
+	}
+	if delay > maxHookDelay {
+		fmt.Printf("notify: %s requested a delay of %s, waiting %s\n", host, delay, maxHookDelay)
+		delay = maxHookDelay
+	}
+
+	hookDelays.Lock()
+	defer hookDelays.Unlock()
+	if until := now.Add(delay); until.After(hookDelays.until[host]) {
+		hookDelays.until[host] = until
+	}
+}
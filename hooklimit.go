@@ -0,0 +1,88 @@
+// hooklimit.go contains the code which bounds the load we place upon
+// each hook, however many feeds share it.
+//
+// Deliveries to the same hook URL are limited to -hook-rate per minute,
+// by spacing them evenly, and to -hook-concurrency in progress at once.
+// Hooks are told apart by their scheme, host, and path, so that hooks
+// differing only in their query, such as a channel parameter, share a
+// limit.
+//
+
+package main
+
+import (
+	"net/url"
+	"sync"
+	"time"
+)
+
+// HookRate is the maximum number of deliveries made to each hook per
+// minute, zero for no limit.
+var HookRate int
+
+// HookConcurrency is the maximum number of deliveries in progress to
+// each hook at once, zero for no limit.
+var HookConcurrency int
+
+// hookLimits holds, for each hook, the time at which the next delivery
+// may be made, and the slots of the deliveries in progress.
+var hookLimits = struct {
+	sync.Mutex
+	next  map[string]time.Time
+	slots map[string]chan struct{}
+}{next: make(map[string]time.Time), slots: make(map[string]chan struct{})}
+
+// hookKey returns the key by which the given hook URL is limited.
+func hookKey(u *url.URL) string {
+	return u.Scheme + "://" + u.Host + u.Path
+}
+
+// acquireHook waits until a delivery may be made to the given hook,
+// returning a function which must be called once it has completed.
+func acquireHook(u *url.URL) func() {
+	if HookRate <= 0 && HookConcurrency <= 0 {
+		return func() {}
+	}
+	key := hookKey(u)
+
+	hookLimits.Lock()
+	var slots chan struct{}
+	if HookConcurrency > 0 {
+		slots = hookLimits.slots[key]
+		if slots == nil {
+			slots = make(chan struct{}, HookConcurrency)
+			hookLimits.slots[key] = slots
+		}
+	}
+	hookLimits.Unlock()
+
+	if slots != nil {
+		slots <- struct{}{}
+	}
+
+	// Reserve the next interval, so that concurrent deliveries are
+	// spaced too.
+	if HookRate > 0 {
+		interval := time.Minute / time.Duration(HookRate)
+
+		hookLimits.Lock()
+		now := time.Now()
+		at := hookLimits.next[key]
+		if at.Before(now) {
+			at = now
+		}
+		hookLimits.next[key] = at.Add(interval)
+		hookLimits.Unlock()
+
+		if wait := time.Until(at); wait > 0 {
+			debug("Waiting %s before delivering to %s, to honour -hook-rate\n", wait, key)
+			time.Sleep(wait)
+		}
+	}
+
+	return func() {
+		if slots != nil {
+			<-slots
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// lease.go contains the code which allows several replicas of rss2hook
+// to run, for availability, with only one of them polling feeds.
+//
+// The replicas share a lease-file, and whichever holds an exclusive
+// lock upon it is the leader.  The lock is released by the kernel when
+// the leader exits, for whatever reason, allowing a standby to take
+// over.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// LeaseRetry is the interval at which standbys attempt to acquire the
+// lease.
+var LeaseRetry = 10 * time.Second
+
+// leaseFile holds the lease, once acquired, so the lock is kept for the
+// lifetime of the process.
+var leaseFile *os.File
+
+// tryLease attempts to acquire the lease held by the given file,
+// returning true if we're now the leader.
+func tryLease(path string) (bool, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return false, err
+	}
+
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		file.Close()
+		return false, nil
+	}
+	if err != nil {
+		file.Close()
+		return false, err
+	}
+
+	// Record who holds the lease, to aid debugging.
+	host, _ := os.Hostname()
+	file.Truncate(0)
+	fmt.Fprintf(file, "%s %d %s\n", host, os.Getpid(), time.Now().Format(time.RFC3339))
+
+	leaseFile = file
+	return true, nil
+}
+
+// acquireLease blocks until we hold the lease upon the given file, and
+// so are the leader.
+func acquireLease(path string) {
+	waiting := false
+
+	for {
+		ok, err := tryLease(path)
+		if err != nil {
+			fmt.Printf("Error acquiring lease %s - %s\n", path, err.Error())
+		}
+		if ok {
+			fmt.Printf("Acquired lease %s, polling feeds\n", path)
+			setMetric("rss2hook_leader", 1)
+			return
+		}
+
+		if !waiting {
+			fmt.Printf("Lease %s is held by another instance, waiting as a standby\n", path)
+			setMetric("rss2hook_leader", 0)
+			waiting = true
+		}
+		time.Sleep(LeaseRetry)
+	}
+}
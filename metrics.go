@@ -0,0 +1,80 @@
+// metrics.go contains a minimal registry of metrics, which may be
+// exported over HTTP in the Prometheus text-format.
+//
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// metrics holds the current value of every metric we export, keyed
+// by the full name of the metric - including any labels.
+var metrics = struct {
+	sync.Mutex
+	values map[string]float64
+}{values: make(map[string]float64)}
+
+// metricName returns the name of a metric with a single label applied.
+func metricName(name string, label string, value string) string {
+	return fmt.Sprintf("%s{%s=%q}", name, label, value)
+}
+
+// setMetric sets the named metric to the given value.
+func setMetric(name string, value float64) {
+	metrics.Lock()
+	defer metrics.Unlock()
+
+	metrics.values[name] = value
+}
+
+// addMetric increments the named metric by the given amount.
+func addMetric(name string, delta float64) {
+	metrics.Lock()
+	defer metrics.Unlock()
+
+	metrics.values[name] += delta
+}
+
+// writeMetrics writes all known metrics to the given writer, sorted by
+// name, in the Prometheus text-format.
+func writeMetrics(w io.Writer) {
+	metrics.Lock()
+	defer metrics.Unlock()
+
+	var names []string
+	for name := range metrics.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(w, "%s %s\n", name,
+			strconv.FormatFloat(metrics.values[name], 'f', -1, 64))
+	}
+}
+
+// MetricsHandler writes all known metrics to the caller, sorted by name.
+func MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writeMetrics(w)
+}
+
+// serveMetrics launches a HTTP-server upon the given address, which
+// will serve our metrics at `/metrics`.
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", MetricsHandler)
+
+	go func() {
+		err := http.ListenAndServe(addr, mux)
+		if err != nil {
+			fmt.Printf("Error serving metrics on %s - %s\n", addr, err.Error())
+		}
+	}()
+}
@@ -0,0 +1,56 @@
+// monotonic.go contains the code for feeds in monotonic mode, whose
+// items are only notified if they're newer than every item seen before.
+//
+// This guards against feeds which reorder their items, or temporarily
+// drop and then restore old items, causing them to be notified again.
+//
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// newestSeen returns the time of the newest item seen in the feed of
+// the given entry, or the zero time if none has been recorded.
+func newestSeen(entry RSSEntry) time.Time {
+	return loadFeedState(seenParent(entry)).NewestItem
+}
+
+// olderThan returns true if the given item was published before the
+// given time.
+//
+// Items without timestamps are exempt, since their age is unknown.
+func olderThan(entry RSSEntry, item *gofeed.Item, newest time.Time) bool {
+	published := itemTime(entry, item)
+	return published != nil && published.Before(newest)
+}
+
+// recordNewest records the time of the given item, which has been
+// recorded as seen, if it is newer than any seen before.
+//
+// Only items which were seen advance the time, so that those deferred,
+// or whose delivery failed, aren't then suppressed as old.  Times in the
+// future are ignored, so that a single misdated item can't suppress
+// every item which follows it.
+func recordNewest(entry RSSEntry, item *gofeed.Item) {
+	published := itemTime(entry, item)
+	if published == nil || published.After(time.Now()) {
+		return
+	}
+
+	parent := seenParent(entry)
+	state := loadFeedState(parent)
+	if !published.After(state.NewestItem) {
+		return
+	}
+
+	state.NewestItem = *published
+	err := saveFeedState(parent, state)
+	if err != nil {
+		fmt.Printf("Error saving state of %s - %s\n", redactCredentials(parent), err.Error())
+	}
+}
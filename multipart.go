@@ -0,0 +1,75 @@
+// multipart.go contains the code which submits items to hooks as files
+// uploaded in a multipart form, for receivers which can't accept a raw
+// JSON body, for example:
+//
+//    https://example.com/feed.rss = https://ingest.example.com/upload
+//     - multipart: item
+//     - form-field: source=rss2hook
+//
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+)
+
+// formField is a field submitted along with the item in a multipart
+// form.
+type formField struct {
+	name  string
+	value string
+}
+
+// parseFormField parses a form-field of the form "name=value".
+func parseFormField(value string) (formField, error) {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return formField{}, fmt.Errorf("malformed form-field '%s', expected 'name=value'", value)
+	}
+	return formField{
+		name:  strings.TrimSpace(parts[0]),
+		value: strings.TrimSpace(parts[1]),
+	}, nil
+}
+
+// multipartBody returns a multipart form containing the given JSON, as a
+// file in the part named by the given entry's multipart option, followed
+// by the entry's form-fields.
+//
+// The content-type of the form, which includes its boundary, is also
+// returned.
+func multipartBody(entry RSSEntry, jsonValue []byte) ([]byte, string, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition",
+		fmt.Sprintf(`form-data; name=%q; filename=%q`, entry.multipart, entry.multipart+".json"))
+	header.Set("Content-Type", "application/json")
+
+	part, err := w.CreatePart(header)
+	if err != nil {
+		return nil, "", err
+	}
+	_, err = part.Write(jsonValue)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, field := range entry.formFields {
+		err = w.WriteField(field.name, field.value)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	err = w.Close()
+	if err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), w.FormDataContentType(), nil
+}
@@ -0,0 +1,381 @@
+// options.go contains the code for parsing the per-feed options which
+// may follow an entry in the configuration file, for example:
+//
+//    https://example.com/feed.rss = https://ntfy.sh/example
+//     - type: ntfy
+//     - priority: high
+//
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseOption parses a single option-line, and applies the option it
+// contains to the given entry.
+func parseOption(entry *RSSEntry, line string) error {
+
+	// Strip the leading "-", and split into key and value.
+	line = strings.TrimSpace(strings.TrimPrefix(line, "-"))
+	parts := strings.SplitN(line, ":", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("malformed option '%s', expected 'key: value'", line)
+	}
+
+	key := strings.ToLower(strings.TrimSpace(parts[0]))
+	value := strings.TrimSpace(parts[1])
+
+	switch key {
+	case "type":
+		switch value {
+		case "http", "ntfy", "gotify", "pagerduty", "teams", "apprise", "smtp":
+			entry.hookType = value
+		default:
+			return fmt.Errorf("unknown hook type '%s'", value)
+		}
+	case "method":
+		switch strings.ToUpper(value) {
+		case "GET", "POST":
+			entry.method = strings.ToUpper(value)
+		default:
+			return fmt.Errorf("unknown method '%s', expected GET or POST", value)
+		}
+	case "body":
+		entry.body = value
+	case "batch":
+		batch, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid batch '%s', expected true or false", value)
+		}
+		if batch && entry.hookTemplate != nil {
+			return fmt.Errorf("templated hooks can't be batched")
+		}
+		entry.batch = batch
+	case "notify-on-change":
+		change, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid notify-on-change '%s', expected true or false", value)
+		}
+		entry.notifyOnChange = change
+	case "missing-link":
+		switch value {
+		case "notify", "skip", "use-guid-as-link":
+			entry.missingLink = value
+		default:
+			return fmt.Errorf("unknown missing-link '%s', expected notify, skip, or use-guid-as-link", value)
+		}
+	case "resolve-links":
+		switch value {
+		case "link", "all":
+			entry.resolveLinks = value
+		default:
+			return fmt.Errorf("unknown resolve-links '%s', expected link or all", value)
+		}
+	case "transform-hook":
+		entry.transformHook = value
+	case "transform-failure":
+		switch value {
+		case "original", "fail":
+			entry.transformFailure = value
+		default:
+			return fmt.Errorf("unknown transform-failure '%s', expected original or fail", value)
+		}
+	case "fallback-hook":
+		fallback, err := newEntry(entry.feed, value)
+		if err != nil {
+			return err
+		}
+		if entry.batch && fallback.hookTemplate != nil {
+			return fmt.Errorf("templated hooks can't be batched")
+		}
+		entry.fallbackHook = value
+	case "fallback-parser":
+		parsers, err := parseFallbackParsers(value)
+		if err != nil {
+			return err
+		}
+		entry.fallbackParsers = parsers
+	case "fallback-pattern":
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return fmt.Errorf("invalid fallback-pattern '%s' - %s", value, err.Error())
+		}
+		entry.fallbackPattern = re
+	case "archive-hook":
+		entry.archiveHook = value
+	case "content-types":
+		entry.contentTypes = parseContentTypes(value)
+	case "cookie":
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return fmt.Errorf("malformed cookie, expected 'name=value'")
+		}
+		entry.cookies = append(entry.cookies, &http.Cookie{
+			Name:  strings.TrimSpace(parts[0]),
+			Value: strings.TrimSpace(parts[1]),
+		})
+	case "charset":
+		if !validCharset(value) {
+			return fmt.Errorf("unknown charset '%s'", value)
+		}
+		entry.charset = value
+	case "accept":
+		entry.accept = value
+	case "scan-limit":
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			return fmt.Errorf("invalid scan-limit '%s', expected a number such as 50, or 0 for none", value)
+		}
+		entry.scanLimit = limit
+	case "fields":
+		entry.fields = parseFields(value)
+	case "multipart":
+		entry.multipart = value
+	case "form-field":
+		field, err := parseFormField(value)
+		if err != nil {
+			return err
+		}
+		entry.formFields = append(entry.formFields, field)
+	case "compress":
+		switch value {
+		case "gzip":
+			entry.compress = value
+		case "none":
+			entry.compress = ""
+		default:
+			return fmt.Errorf("unknown compression '%s', expected gzip or none", value)
+		}
+	case "id":
+		entry.id = value
+	case "dedup":
+		switch value {
+		case "guid", "link":
+			entry.dedup = value
+		default:
+			return fmt.Errorf("unknown dedup '%s', expected guid or link", value)
+		}
+	case "monotonic":
+		monotonic, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid monotonic '%s', expected true or false", value)
+		}
+		entry.monotonic = monotonic
+	case "normalize-guid":
+		normalize, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid normalize-guid '%s', expected true or false", value)
+		}
+		entry.normalizeGUID = normalize
+	case "basic-auth":
+		username, password, err := parseBasicAuth(value)
+		if err != nil {
+			return err
+		}
+		entry.username = username
+		entry.password = password
+	case "auth-secret":
+		entry.authSecret = value
+	case "auth-header":
+		entry.authHeader = http.CanonicalHeaderKey(value)
+	case "hook-base":
+		if value != "none" {
+			return fmt.Errorf("unknown hook-base '%s', expected none", value)
+		}
+		entry.noHookBase = true
+	case "include", "exclude":
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s pattern '%s' - %s", key, value, err.Error())
+		}
+		if key == "include" {
+			entry.include = append(entry.include, re)
+		} else {
+			entry.exclude = append(entry.exclude, re)
+		}
+	case "title-prefix":
+		entry.titlePrefix = value
+	case "title-template":
+		tmpl, err := parseTitleTemplate(value)
+		if err != nil {
+			return fmt.Errorf("invalid title-template '%s' - %s", value, err.Error())
+		}
+		entry.titleTemplate = tmpl
+	case "redact":
+		if entry.redactFields == nil {
+			entry.redactFields = make(map[string]bool)
+		}
+		entry.redactFields[value] = true
+	case "redact-pattern":
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return fmt.Errorf("invalid redact-pattern '%s' - %s", value, err.Error())
+		}
+		entry.redactPatterns = append(entry.redactPatterns, re)
+	case "expression":
+		expr, err := parseExpr(value)
+		if err != nil {
+			return fmt.Errorf("invalid expression '%s' - %s", value, err.Error())
+		}
+		entry.expression = expr
+	case "full-content":
+		full, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid full-content '%s', expected true or false", value)
+		}
+		entry.fullContent = full
+	case "max-body-field":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid max-body-field '%s', expected a length, or 0 for no limit", value)
+		}
+		entry.maxBodyField = n
+	case "same-domain-only":
+		same, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid same-domain-only '%s', expected true or false", value)
+		}
+		entry.sameDomainOnly = same
+	case "deny-domain":
+		entry.deniedDomains = append(entry.deniedDomains, parseDomains(value)...)
+	case "priority":
+		priority, err := parsePriority(value)
+		if err != nil {
+			return err
+		}
+		entry.priority = priority
+	case "priority-rule":
+		rule, err := parsePriorityRule(value)
+		if err != nil {
+			return err
+		}
+		entry.priorityRules = append(entry.priorityRules, rule)
+	case "tags":
+		entry.tags = value
+	case "token":
+		entry.token = value
+	case "success-codes":
+		codes, err := parseStatusCodes(value)
+		if err != nil {
+			return err
+		}
+		entry.successCodes = codes
+	case "apprise-urls":
+		entry.appriseURLs = value
+	case "mail-from":
+		entry.mailFrom = value
+	case "mail-to":
+		entry.mailTo = value
+	case "mail-format":
+		switch value {
+		case "text", "html":
+			entry.mailFormat = value
+		default:
+			return fmt.Errorf("unknown mail-format '%s', expected text or html", value)
+		}
+	case "routing-key":
+		entry.routingKey = value
+	case "severity":
+		switch value {
+		case "critical", "error", "warning", "info":
+			entry.severity = value
+		default:
+			return fmt.Errorf("unknown severity '%s', expected critical, error, warning, or info", value)
+		}
+	case "timeout":
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid timeout '%s', expected a duration such as 30s", value)
+		}
+		entry.timeout = timeout
+	case "hook-timeout":
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid hook-timeout '%s', expected a duration such as 30s", value)
+		}
+		entry.hookTimeout = timeout
+	case "retries":
+		retries, err := strconv.Atoi(value)
+		if err != nil || retries < 0 {
+			return fmt.Errorf("invalid retries '%s', expected a number such as 3, or 0 for none", value)
+		}
+		entry.retries = retries
+	case "cooldown":
+		cooldown, err := time.ParseDuration(value)
+		if err != nil || cooldown < 0 {
+			return fmt.Errorf("invalid cooldown '%s', expected a duration such as 24h, or 0 for none", value)
+		}
+		entry.cooldown = cooldown
+	case "settle":
+		settle, err := time.ParseDuration(value)
+		if err != nil || settle < 0 {
+			return fmt.Errorf("invalid settle '%s', expected a duration such as 10m, or 0 for none", value)
+		}
+		entry.settle = settle
+	case "timestamp":
+		switch value {
+		case "published", "updated", "auto":
+			entry.timestamp = value
+		default:
+			return fmt.Errorf("unknown timestamp '%s', expected published, updated, or auto", value)
+		}
+	default:
+		return fmt.Errorf("unknown option '%s'", key)
+	}
+
+	entry.options = append(entry.options, key+": "+value)
+	return nil
+}
+
+// checkOptions returns an error if the options of the given entry, once
+// they have all been parsed, are incomplete; those which depend upon
+// each other can't be checked as each is parsed.
+func checkOptions(entry RSSEntry) error {
+	if entry.hookType == "smtp" && (entry.mailFrom == "" || len(parseAddresses(entry.mailTo)) == 0) {
+		return fmt.Errorf("the smtp hook type requires mail-from and mail-to")
+	}
+	return nil
+}
+
+// resolveOptions returns the given entry with every option which was
+// not given replaced by its default, or the value of the corresponding
+// global flag, so that the settings in effect for each feed are known
+// once the configuration has been loaded.
+//
+// This must be called after the global flags have been parsed.
+func resolveOptions(entry RSSEntry) RSSEntry {
+	if entry.timeout == 0 {
+		entry.timeout = Timeout
+	}
+	if entry.hookTimeout == 0 {
+		entry.hookTimeout = HookTimeout
+	}
+	if entry.retries < 0 {
+		entry.retries = Retries
+	}
+	if entry.maxBodyField < 0 {
+		entry.maxBodyField = MaxBodyField
+	}
+	if entry.cooldown < 0 {
+		entry.cooldown = Cooldown
+	}
+	if entry.dedup == "" {
+		entry.dedup = "guid"
+	}
+	if entry.missingLink == "" {
+		entry.missingLink = "notify"
+	}
+	if entry.timestamp == "" {
+		entry.timestamp = "auto"
+	}
+	if entry.accept == "" {
+		entry.accept = DefaultAccept
+	}
+	return entry
+}
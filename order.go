@@ -0,0 +1,63 @@
+// order.go contains the code which notifies the new items of every feed
+// as a single stream, in the order they were published, rather than
+// feed by feed, when launched with `-order global`.
+//
+// This gives a receiver which is sent items from many feeds, such as a
+// single chat channel, a coherent timeline.  The new items are held
+// until every feed has been polled, then sorted and notified.
+//
+
+package main
+
+import (
+	"sort"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// cycleItem is a new item, held until every feed has been polled.
+type cycleItem struct {
+	entry RSSEntry
+	item  *gofeed.Item
+}
+
+// cycleItems holds the new items found by the current poll of the
+// feeds, if the order is global.
+//
+// The caller must hold ScanLock to access it.
+var cycleItems []cycleItem
+
+// holdItem holds the given new item, of the given entry, until every
+// feed has been polled.
+func holdItem(entry RSSEntry, item *gofeed.Item) {
+	cycleItems = append(cycleItems, cycleItem{entry: entry, item: item})
+}
+
+// notifyHeld notifies the items held by holdItem, oldest first, and
+// records those which were notified successfully.
+//
+// Items which lack a timestamp are notified after the others, in the
+// order in which they were found.
+//
+// The caller must hold ScanLock.
+func notifyHeld() {
+	held := cycleItems
+	cycleItems = nil
+
+	sort.SliceStable(held, func(a, b int) bool {
+		ta := itemTime(held[a].entry, held[a].item)
+		tb := itemTime(held[b].entry, held[b].item)
+		return ta != nil && (tb == nil || ta.Before(*tb))
+	})
+
+	for _, h := range held {
+		if stopping() {
+			return
+		}
+		err := notify(h.entry, h.item)
+		summarizeNotify(h.entry, 1, err)
+		if err == nil {
+			recordNotified(h.entry, h.item)
+		}
+	}
+}
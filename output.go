@@ -0,0 +1,67 @@
+// output.go contains the code which writes the requests we'd make to
+// hooks into a directory, rather than making them.
+//
+// This allows payloads, and templates, to be tested without a live
+// receiver.  Each request is written to its own file, named for the time
+// it was made.
+//
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// OutputDir is the directory into which the requests we'd make to hooks
+// are written, if set.
+var OutputDir string
+
+// writeOutput writes the given body, which would have been submitted to
+// the given hook, to a new file within OutputDir.
+func writeOutput(hook string, contentType string, body []byte) error {
+	err := os.MkdirAll(OutputDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	ext := ".txt"
+	if strings.Contains(contentType, "json") {
+		ext = ".json"
+	}
+	stamp := time.Now().UTC().Format("20060102T150405.000000000Z")
+
+	file, err := ioutil.TempFile(OutputDir, stamp+"-*"+ext)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(body)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %s, for %s\n", file.Name(), hook)
+	return nil
+}
+
+// writeRequest writes the body of the given request to a new file within
+// OutputDir.
+func writeRequest(req *http.Request) error {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return writeOutput(redactURL(req.URL), req.Header.Get("Content-Type"), body)
+}
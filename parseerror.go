@@ -0,0 +1,94 @@
+// parseerror.go contains the code which backs off polling of feeds which
+// are fetched successfully, but repeatedly fail to parse.
+//
+// A feed serving malformed XML will usually continue to do so until it
+// is fixed, so rather than parsing it, and logging the same error, upon
+// every poll it is retried after an interval which doubles with each
+// consecutive failure.  Other failures to read a feed, such as timeouts,
+// are typically transient, and don't affect the interval.
+//
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// ParseBackoff is the interval after which a feed which failed to parse
+// is retried, doubled for each further failure, zero disables backoff.
+var ParseBackoff time.Duration
+
+// ParseBackoffMax is the longest interval after which a feed which
+// failed to parse is retried.
+var ParseBackoffMax time.Duration
+
+// UnparseableAfter is the number of consecutive failures to parse a
+// feed after which it is reported as persistently unparseable.
+const UnparseableAfter = 5
+
+// parseBackingOff returns true if the given feed has failed to parse,
+// and shouldn't be retried yet.
+func parseBackingOff(feed string) bool {
+	state := loadFeedState(feed)
+	if ParseBackoff <= 0 || !time.Now().Before(state.ParseRetryAt) {
+		return false
+	}
+
+	debug("Skipping %s - failed to parse %d times, retrying after %s\n",
+		redactCredentials(feed), state.ParseFailures, state.ParseRetryAt.Format(time.RFC3339))
+	return true
+}
+
+// recordParse records whether the given feed was parsed, updating its
+// streak of failures, and the time after which it should be retried.
+func recordParse(feed string, parsed bool) {
+	state := loadFeedState(feed)
+	if parsed && state.ParseFailures == 0 {
+		return
+	}
+
+	if parsed {
+		if state.ParseFailures >= UnparseableAfter {
+			fmt.Printf("%s parsed successfully after %d failures\n", redactCredentials(feed), state.ParseFailures)
+		}
+		state.ParseFailures = 0
+		state.ParseRetryAt = time.Time{}
+	} else {
+		state.ParseFailures++
+		if ParseBackoff > 0 {
+			state.ParseRetryAt = time.Now().Add(parseInterval(state.ParseFailures))
+		}
+		if state.ParseFailures == UnparseableAfter {
+			fmt.Printf("Warning: %s is persistently unparseable, having failed to parse %d times in a row\n",
+				redactCredentials(feed), state.ParseFailures)
+		}
+	}
+
+	err := saveFeedState(feed, state)
+	if err != nil {
+		fmt.Printf("Error saving state of %s - %s\n", redactCredentials(feed), err.Error())
+	}
+
+	unparseable := 0.0
+	if state.ParseFailures >= UnparseableAfter {
+		unparseable = 1
+	}
+	setMetric(metricName("rss2hook_feed_unparseable", "feed", redactCredentials(feed)), unparseable)
+}
+
+// parseInterval returns the interval after which a feed which has failed
+// to parse the given number of times in a row is retried.
+func parseInterval(failures int) time.Duration {
+	interval := ParseBackoff
+	for i := 1; i < failures && i < 32; i++ {
+		if ParseBackoffMax > 0 && interval >= ParseBackoffMax {
+			break
+		}
+		interval *= 2
+	}
+	if ParseBackoffMax > 0 && interval > ParseBackoffMax {
+		interval = ParseBackoffMax
+	}
+	return interval
+}
@@ -0,0 +1,288 @@
+// parsefallback.go contains the code which rescues feeds that gofeed
+// can't parse, by trying the fallback parsers configured for them, in
+// turn:
+//
+//    jsonfeed  - parse the body as a JSON Feed, served mislabelled.
+//    discover  - find the feed linked from a HTML page, via a
+//                <link rel="alternate">, and parse that instead; so
+//                long as it is upon the same host.
+//    regex     - treat each match of the feed's fallback-pattern as an
+//                item, whose link and title are the groups named "link"
+//                and "title", or the whole match.
+//
+// Fallbacks are opt-in, for each feed, so that a feed which breaks is
+// reported as such unless it's known to need them.
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/mmcdole/gofeed"
+)
+
+// parseFallbackParsers parses the comma-separated list of fallback
+// parsers given as an option.
+func parseFallbackParsers(value string) ([]string, error) {
+	var parsers []string
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		switch name {
+		case "jsonfeed", "discover", "regex":
+			parsers = append(parsers, name)
+		default:
+			return nil, fmt.Errorf("unknown fallback-parser '%s', expected jsonfeed, discover, or regex", name)
+		}
+	}
+	return parsers, nil
+}
+
+// parsesHTML returns true if the given entry has a fallback parser which
+// reads HTML pages, rather than feeds.
+func parsesHTML(entry RSSEntry) bool {
+	for _, name := range entry.fallbackParsers {
+		if name == "discover" || name == "regex" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseWithFallback parses the given body of the feed of the given
+// entry, trying its fallback parsers if gofeed fails.
+//
+// If every parser fails the error of gofeed is returned, as that is
+// the most useful in diagnosing a broken feed.
+func parseWithFallback(entry RSSEntry, data []byte) (*gofeed.Feed, error) {
+	feed, err := gofeed.NewParser().Parse(bytes.NewReader(data))
+	if err == nil {
+		return feed, nil
+	}
+
+	for _, name := range entry.fallbackParsers {
+		var rescued *gofeed.Feed
+		var ferr error
+
+		switch name {
+		case "jsonfeed":
+			rescued, ferr = parseJSONFeed(data)
+		case "discover":
+			rescued, ferr = parseDiscovered(entry, data)
+		case "regex":
+			rescued, ferr = parsePattern(entry, data)
+		}
+		if ferr == nil {
+			debug("Parsed %s with the %s fallback parser, gofeed failed - %s\n", redactCredentials(entry.feed), name, err.Error())
+			return rescued, nil
+		}
+		debug("Fallback parser %s failed for %s - %s\n", name, redactCredentials(entry.feed), ferr.Error())
+	}
+	return nil, err
+}
+
+// jsonFeedID returns the given id of a JSON Feed item as a string.
+//
+// The specification requires a string, but some feeds give a number.
+func jsonFeedID(raw json.RawMessage) string {
+	var id string
+	if json.Unmarshal(raw, &id) == nil {
+		return id
+	}
+	var n json.Number
+	if json.Unmarshal(raw, &n) == nil {
+		return n.String()
+	}
+	return ""
+}
+
+// parseJSONFeed parses the given body as a JSON Feed.
+//
+// See https://jsonfeed.org/version/1.1 for the format.
+func parseJSONFeed(data []byte) (*gofeed.Feed, error) {
+	type jsonAuthor struct {
+		Name string `json:"name"`
+	}
+	var doc struct {
+		Version     string `json:"version"`
+		Title       string `json:"title"`
+		HomePageURL string `json:"home_page_url"`
+		Description string `json:"description"`
+		Items       []struct {
+			ID            json.RawMessage `json:"id"`
+			URL           string          `json:"url"`
+			Title         string          `json:"title"`
+			ContentHTML   string          `json:"content_html"`
+			ContentText   string          `json:"content_text"`
+			Summary       string          `json:"summary"`
+			DatePublished string          `json:"date_published"`
+			DateModified  string          `json:"date_modified"`
+			Tags          []string        `json:"tags"`
+			Author        *jsonAuthor     `json:"author"`
+			Authors       []jsonAuthor    `json:"authors"`
+		} `json:"items"`
+	}
+
+	err := json.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.Contains(doc.Version, "jsonfeed.org") {
+		return nil, fmt.Errorf("not a JSON Feed")
+	}
+
+	feed := &gofeed.Feed{
+		Title:       doc.Title,
+		Link:        doc.HomePageURL,
+		Description: doc.Description,
+		FeedType:    "json",
+	}
+	for _, i := range doc.Items {
+		item := &gofeed.Item{
+			GUID:        jsonFeedID(i.ID),
+			Link:        i.URL,
+			Title:       i.Title,
+			Description: i.Summary,
+			Content:     i.ContentHTML,
+			Categories:  i.Tags,
+			Published:   i.DatePublished,
+			Updated:     i.DateModified,
+		}
+		if item.Content == "" {
+			item.Content = i.ContentText
+		}
+		if i.Author == nil && len(i.Authors) > 0 {
+			i.Author = &i.Authors[0]
+		}
+		if i.Author != nil {
+			item.Author = &gofeed.Person{Name: i.Author.Name}
+		}
+		if t, err := time.Parse(time.RFC3339, i.DatePublished); err == nil {
+			item.PublishedParsed = &t
+		}
+		if t, err := time.Parse(time.RFC3339, i.DateModified); err == nil {
+			item.UpdatedParsed = &t
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	return feed, nil
+}
+
+// discoveredLimit is the maximum size of a feed found via discovery.
+const discoveredLimit = 10 * 1024 * 1024
+
+// parseDiscovered finds the feed linked from the given HTML page, of the
+// given entry, and fetches and parses it.
+//
+// Only a feed upon the same host as the page is followed, and it is
+// checked, and decoded, as the page itself would be.
+func parseDiscovered(entry RSSEntry, data []byte) (*gofeed.Feed, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	href := ""
+	doc.Find(`link[rel~="alternate"]`).EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		kind, _ := s.Attr("type")
+		switch strings.ToLower(strings.TrimSpace(kind)) {
+		case "application/rss+xml", "application/atom+xml", "application/feed+json":
+			href, _ = s.Attr("href")
+		}
+		return href == ""
+	})
+	if href == "" {
+		return nil, fmt.Errorf("no feed is linked")
+	}
+
+	base, err := url.Parse(entry.feed)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return nil, err
+	}
+	target := base.ResolveReference(ref)
+	if target.Host != base.Host {
+		return nil, fmt.Errorf("the linked feed %s isn't upon %s", target, base.Host)
+	}
+	link := target.String()
+	debug("Found the feed %s linked from %s\n", redactCredentials(link), redactCredentials(entry.feed))
+
+	req, err := http.NewRequest("GET", link, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "rss2email (https://github.com/skx/rss2email)")
+	req.Header.Set("Accept", DefaultAccept)
+
+	resp, err := fetchClient(entry).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("unexpected status-code %d from %s", resp.StatusCode, link)
+	}
+	err = checkContentType(entry, resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+
+	body := ioutil.NopCloser(io.LimitReader(resp.Body, discoveredLimit))
+	decoded, err := decodeFeed(entry, resp.Header.Get("Content-Type"), body)
+	if err != nil {
+		return nil, err
+	}
+	defer decoded.Close()
+
+	feed, err := gofeed.NewParser().Parse(decoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s - %s", link, err.Error())
+	}
+	return feed, nil
+}
+
+// parsePattern creates a feed holding an item for each match of the
+// fallback-pattern of the given entry within the given body.
+func parsePattern(entry RSSEntry, data []byte) (*gofeed.Feed, error) {
+	re := entry.fallbackPattern
+	if re == nil {
+		return nil, fmt.Errorf("no fallback-pattern is set")
+	}
+
+	feed := &gofeed.Feed{Link: entry.feed}
+	for _, match := range re.FindAllSubmatch(data, -1) {
+		item := &gofeed.Item{Link: string(match[0])}
+		for i, name := range re.SubexpNames() {
+			switch name {
+			case "link":
+				item.Link = string(match[i])
+			case "title":
+				item.Title = string(match[i])
+			}
+		}
+		item.Link = strings.TrimSpace(item.Link)
+		item.Title = strings.TrimSpace(item.Title)
+		if item.Title == "" {
+			item.Title = item.Link
+		}
+		item.GUID = item.Link
+		feed.Items = append(feed.Items, item)
+	}
+	if len(feed.Items) == 0 {
+		return nil, fmt.Errorf("fallback-pattern didn't match")
+	}
+	return feed, nil
+}
@@ -0,0 +1,156 @@
+// payload.go contains the code which builds the object we submit
+// to webhooks for each new feed-item.
+//
+
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// Payload is the object submitted to a webhook when a new item appears
+// in a feed.
+//
+// It contains the feed-item itself, along with some fields which are
+// computed from it.  The exported fields are available to templates
+// too.
+type Payload struct {
+	*gofeed.Item
+
+	// Domain is the host-part of the item's link.
+	Domain string `json:"domain,omitempty"`
+
+	// Age is the number of seconds since the item was published.
+	Age int64 `json:"age,omitempty"`
+
+	// Timestamp is the time the item was published, in RFC3339 format.
+	Timestamp string `json:"timestamp,omitempty"`
+
+	// Priority is the priority of the item, from 1 to 5, if configured.
+	Priority int `json:"priority,omitempty"`
+
+	// Length is the number of characters, and Words the number of
+	// words, in the plain-text of the item's content, or description
+	// if it has no content.
+	Length int `json:"length"`
+	Words  int `json:"words"`
+
+	// FullContent is the text of the article the item links to, if
+	// the feed's full-content option is set and it could be fetched.
+	FullContent string `json:"fullContent,omitempty"`
+
+	// The iTunes fields of podcast episodes, if present.
+	podcastFields
+}
+
+// MaxBodyField limits the length of the description, and content, of
+// the items in payloads, zero disables the limit.
+var MaxBodyField int
+
+// newPayload creates the payload for the given feed-item, with the given
+// priority.
+func newPayload(entry RSSEntry, item *gofeed.Item, priority int) *Payload {
+
+	p := &Payload{
+		Item:          limitBody(entry, item),
+		Priority:      priority,
+		podcastFields: newPodcastFields(item),
+	}
+
+	if u, err := url.Parse(item.Link); err == nil {
+		p.Domain = u.Hostname()
+	}
+
+	// Count the text, rather than the markup.
+	text := plainText(item.Content)
+	if text == "" {
+		text = plainText(item.Description)
+	}
+	p.Length = len([]rune(text))
+	p.Words = len(strings.Fields(text))
+
+	// Fetch the full article, if we should, falling back to the
+	// summary if that fails.
+	if entry.fullContent && item.Link != "" {
+		content, err := fetchFullContent(item.Link)
+		if err != nil {
+			fmt.Printf("Failed to fetch full content of %s - %s\n", item.Link, err.Error())
+		} else if entry.redactFields["fullContent"] {
+			p.FullContent = Redacted
+		} else {
+			p.FullContent = redactText(entry, content)
+		}
+	}
+
+	if published := itemTime(entry, item); published != nil {
+		p.Age = int64(time.Since(*published).Seconds())
+		p.Timestamp = published.UTC().Format(time.RFC3339)
+	}
+
+	return p
+}
+
+// limitBody returns the given item with its description, and content,
+// truncated to the maximum length configured for the given entry.
+//
+// The item is copied, rather than modified, if it must be truncated.
+func limitBody(entry RSSEntry, item *gofeed.Item) *gofeed.Item {
+	limit := MaxBodyField
+	if entry.maxBodyField >= 0 {
+		limit = entry.maxBodyField
+	}
+	if limit <= 0 {
+		return item
+	}
+
+	truncated := *item
+	truncated.Description = truncate(item.Description, limit)
+	truncated.Content = truncate(item.Content, limit)
+	return &truncated
+}
+
+// itemTime returns the canonical time of the given item, as selected by
+// the feed's timestamp option:
+//
+// "published" uses the publication time, "updated" the update time, and
+// "auto" the publication time, falling back to the update time.
+//
+// If the selected time is not present nil is returned.
+func itemTime(entry RSSEntry, item *gofeed.Item) *time.Time {
+	switch entry.timestamp {
+	case "published":
+		return item.PublishedParsed
+	case "updated":
+		return item.UpdatedParsed
+	}
+
+	if item.PublishedParsed != nil {
+		return item.PublishedParsed
+	}
+	return item.UpdatedParsed
+}
+
+// plainText converts the given HTML to plain text, by removing any
+// tags and collapsing whitespace.
+func plainText(content string) string {
+	tags := regexp.MustCompile(`<[^>]*>`)
+	content = html.UnescapeString(tags.ReplaceAllString(content, " "))
+	return strings.Join(strings.Fields(content), " ")
+}
+
+// truncate shortens the given text to at most the specified number of
+// characters, appending an ellipsis if anything was removed.
+func truncate(text string, length int) string {
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+	return strings.TrimSpace(string(runes[:length])) + "…"
+}
@@ -0,0 +1,86 @@
+// podcast.go contains the code which surfaces the iTunes extensions of
+// podcast episodes as top-level fields of the payload, so that hooks
+// needn't dig through the extensions themselves:
+//
+//    duration     - the length of the episode, in seconds.
+//    episode      - the number of the episode.
+//    season       - the number of the season.
+//    episodeType  - "full", "trailer", or "bonus".
+//    explicit     - true if the episode is marked as explicit.
+//
+// Each is present only if the feed supplies it, so the payloads of
+// other feeds are unaffected.
+//
+
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// podcastFields are the iTunes fields of an episode, as submitted.
+type podcastFields struct {
+	Duration    int    `json:"duration,omitempty"`
+	Episode     int    `json:"episode,omitempty"`
+	Season      int    `json:"season,omitempty"`
+	EpisodeType string `json:"episodeType,omitempty"`
+	Explicit    *bool  `json:"explicit,omitempty"`
+}
+
+// itunesValue returns the value of the named iTunes element of the given
+// item, or "" if it has none.
+//
+// Our version of gofeed doesn't parse the episode, season, or type of
+// episodes, so these are read from the raw extensions.
+func itunesValue(item *gofeed.Item, name string) string {
+	for _, ext := range item.Extensions["itunes"][name] {
+		if value := strings.TrimSpace(ext.Value); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// parseDuration parses the duration of an episode, which may be given as
+// a number of seconds, or as "MM:SS" or "HH:MM:SS", returning zero if it
+// can't be parsed.
+func parseDuration(value string) int {
+	seconds := 0
+	for _, part := range strings.Split(value, ":") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n < 0 {
+			return 0
+		}
+		seconds = seconds*60 + n
+	}
+	return seconds
+}
+
+// newPodcastFields returns the iTunes fields of the given item.
+func newPodcastFields(item *gofeed.Item) podcastFields {
+	var p podcastFields
+
+	duration := itunesValue(item, "duration")
+	explicit := itunesValue(item, "explicit")
+	if item.ITunesExt != nil {
+		duration = strings.TrimSpace(item.ITunesExt.Duration)
+		explicit = strings.TrimSpace(item.ITunesExt.Explicit)
+	}
+
+	p.Duration = parseDuration(duration)
+	p.Episode, _ = strconv.Atoi(itunesValue(item, "episode"))
+	p.Season, _ = strconv.Atoi(itunesValue(item, "season"))
+	p.EpisodeType = strings.ToLower(itunesValue(item, "episodeType"))
+
+	switch strings.ToLower(explicit) {
+	case "yes", "true", "explicit":
+		p.Explicit = new(bool)
+		*p.Explicit = true
+	case "no", "false", "clean":
+		p.Explicit = new(bool)
+	}
+	return p
+}
@@ -0,0 +1,113 @@
+// preflight.go contains the checks which may be carried out at startup,
+// to catch misconfiguration before the first feed-item is processed.
+//
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// checkStateWritable confirms that we can record items as seen, by
+// writing and removing a test file beneath our state directory.
+func checkStateWritable() error {
+	err := os.MkdirAll(seenDir(), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	file, err := ioutil.TempFile(seenDir(), ".preflight")
+	if err != nil {
+		return err
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
+
+// probeHook makes a request, with the given method, to the hook and
+// returns the resulting status-code.
+//
+// Any response at all shows the hook is reachable, so the status-code
+// is informational only.
+func probeHook(hook string, method string) (int, error) {
+	req, err := http.NewRequest(method, hook, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := HookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+	return res.StatusCode, nil
+}
+
+// distinctHooks returns the hooks of the loaded entries which may be
+// probed over HTTP, with duplicates removed.
+func distinctHooks() []string {
+	var hooks []string
+	seen := make(map[string]bool)
+
+	for _, entry := range Loaded {
+		if isAWSHook(entry.hook) || entry.hookType == "smtp" || seen[entry.hook] {
+			continue
+		}
+		seen[entry.hook] = true
+		hooks = append(hooks, entry.hook)
+	}
+	return hooks
+}
+
+// preflight runs our startup checks, and returns false if any of them
+// failed.
+func preflight() bool {
+	ok := true
+
+	if err := checkStateWritable(); err != nil {
+		fmt.Printf("Preflight: state directory %s is not writable - %s\n", seenDir(), err.Error())
+		ok = false
+	} else {
+		fmt.Printf("Preflight: state directory %s is writable\n", seenDir())
+	}
+
+	for _, hook := range distinctHooks() {
+		status, err := probeHook(hook, "HEAD")
+		if err != nil {
+			fmt.Printf("Preflight: hook %s is unreachable - %s\n", hook, err.Error())
+			ok = false
+			continue
+		}
+		fmt.Printf("Preflight: hook %s is reachable - status %d\n", hook, status)
+	}
+	return ok
+}
+
+// probeHooks makes a request, with the given method, to each distinct
+// hook and reports whether it is reachable, and the status it returned.
+//
+// It returns false if any hook was unreachable.  Templated hooks are
+// only rendered for items, so can't be probed.
+func probeHooks(method string) bool {
+	ok := true
+
+	for _, hook := range distinctHooks() {
+		if strings.Contains(hook, "{{") {
+			fmt.Printf("SKIP %s - templated\n", hook)
+			continue
+		}
+
+		status, err := probeHook(hook, method)
+		if err != nil {
+			fmt.Printf("DOWN %s - %s\n", hook, err.Error())
+			ok = false
+			continue
+		}
+		fmt.Printf("UP   %s - %d %s\n", hook, status, http.StatusText(status))
+	}
+	return ok
+}
@@ -0,0 +1,88 @@
+// priority.go contains the code which determines the priority of the
+// notification sent for a feed-item.
+//
+// Priorities range from 1 (min) to 5 (urgent), as used by ntfy, with
+// zero meaning no priority was configured.
+//
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// priorityRule raises the priority of items which contain a keyword.
+type priorityRule struct {
+	// The keyword to look for in the item's title and categories.
+	keyword string
+
+	// The priority to apply to matching items.
+	priority int
+}
+
+// priorityNames maps the names of the priorities to their values.
+var priorityNames = map[string]int{
+	"min":     1,
+	"low":     2,
+	"default": 3,
+	"high":    4,
+	"max":     5,
+	"urgent":  5,
+}
+
+// parsePriority parses a priority, specified by name or number.
+func parsePriority(value string) (int, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+
+	if n, ok := priorityNames[value]; ok {
+		return n, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > 5 {
+		return 0, fmt.Errorf("invalid priority '%s'", value)
+	}
+	return n, nil
+}
+
+// parsePriorityRule parses a rule of the form "keyword=priority".
+func parsePriorityRule(value string) (priorityRule, error) {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return priorityRule{}, fmt.Errorf("malformed priority rule '%s', expected 'keyword=priority'", value)
+	}
+
+	priority, err := parsePriority(parts[1])
+	if err != nil {
+		return priorityRule{}, err
+	}
+	return priorityRule{
+		keyword:  strings.ToLower(strings.TrimSpace(parts[0])),
+		priority: priority,
+	}, nil
+}
+
+// itemPriority returns the priority of the notification for the given
+// item.
+//
+// The first rule whose keyword appears in the item's title, or in one
+// of its categories, sets the priority, otherwise the feed's default
+// priority is used.
+func itemPriority(entry RSSEntry, item *gofeed.Item) int {
+	title := strings.ToLower(item.Title)
+
+	for _, rule := range entry.priorityRules {
+		if strings.Contains(title, rule.keyword) {
+			return rule.priority
+		}
+		for _, category := range item.Categories {
+			if strings.Contains(strings.ToLower(category), rule.keyword) {
+				return rule.priority
+			}
+		}
+	}
+	return entry.priority
+}
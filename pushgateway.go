@@ -0,0 +1,73 @@
+// pushgateway.go contains the code which pushes our metrics to a
+// Prometheus Pushgateway at the end of a -once run, since there is no
+// long-lived process to scrape.
+//
+// Along with the usual metrics those of the run itself are pushed:
+//
+//    rss2hook_run_duration_seconds        - how long the poll took.
+//    rss2hook_run_feeds                   - the number of feeds read.
+//    rss2hook_run_items_notified          - the number of items notified.
+//    rss2hook_run_errors                  - the number of failures.
+//    rss2hook_run_completed_timestamp_seconds
+//                                         - when the run completed.
+//
+// The metrics replace any previously pushed for the same job.
+//
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Pushgateway is the URL of the Pushgateway to which the metrics of a
+// -once run are pushed, if set.
+var Pushgateway string
+
+// PushJob is the job label under which metrics are pushed.
+var PushJob string
+
+// pushMetrics pushes our metrics, and those of the poll just made, to
+// the Pushgateway.
+//
+// The caller must have made the poll via checkFeeds, so that its summary
+// is complete.
+func pushMetrics() error {
+	if Pushgateway == "" {
+		return nil
+	}
+
+	setMetric("rss2hook_run_duration_seconds", time.Since(summary.Started).Seconds())
+	setMetric("rss2hook_run_feeds", float64(summary.Feeds))
+	setMetric("rss2hook_run_items_notified", float64(summary.Items))
+	setMetric("rss2hook_run_errors", float64(summary.Errors))
+	setMetric("rss2hook_run_completed_timestamp_seconds", float64(time.Now().Unix()))
+
+	var body bytes.Buffer
+	writeMetrics(&body)
+
+	target := strings.TrimSuffix(Pushgateway, "/") + "/metrics/job/" + url.PathEscape(PushJob)
+	req, err := http.NewRequest("PUT", target, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	res, err := HookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		reply, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("status code %d: %s", res.StatusCode, strings.TrimSpace(string(reply)))
+	}
+	return nil
+}
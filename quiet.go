@@ -0,0 +1,94 @@
+// quiet.go contains the code for quiet hours; a daily window during
+// which new items are not notified.
+//
+// Items which appear during quiet hours are either deferred, and so
+// notified once the window ends, or suppressed, and so recorded as seen
+// without ever being notified.
+//
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// QuietHours holds the window during which items are not notified.
+var QuietHours struct {
+	// Enabled is set if quiet hours have been configured.
+	Enabled bool
+
+	// Start and End are the bounds of the window, in minutes after
+	// midnight.  If End is before Start the window spans midnight.
+	Start int
+	End   int
+
+	// Location is the timezone in which the window is given.
+	Location *time.Location
+
+	// Mode is either "defer" or "suppress".
+	Mode string
+}
+
+// parseClock parses a time of day, of the form "HH:MM", returning the
+// number of minutes after midnight.
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time '%s', expected HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// setupQuietHours configures quiet hours from the given window, of the
+// form "22:00-07:00", timezone, and mode.
+func setupQuietHours(window string, zone string, mode string) error {
+	parts := strings.SplitN(window, "-", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid quiet hours '%s', expected HH:MM-HH:MM", window)
+	}
+
+	start, err := parseClock(parts[0])
+	if err != nil {
+		return err
+	}
+	end, err := parseClock(parts[1])
+	if err != nil {
+		return err
+	}
+
+	location := time.Local
+	if zone != "" {
+		location, err = time.LoadLocation(zone)
+		if err != nil {
+			return err
+		}
+	}
+
+	if mode != "defer" && mode != "suppress" {
+		return fmt.Errorf("unknown quiet mode '%s', expected defer or suppress", mode)
+	}
+
+	QuietHours.Enabled = true
+	QuietHours.Start = start
+	QuietHours.End = end
+	QuietHours.Location = location
+	QuietHours.Mode = mode
+	return nil
+}
+
+// inQuietHours returns true if the given time falls within quiet hours.
+func inQuietHours(now time.Time) bool {
+	if !QuietHours.Enabled {
+		return false
+	}
+
+	now = now.In(QuietHours.Location)
+	minute := now.Hour()*60 + now.Minute()
+
+	if QuietHours.Start <= QuietHours.End {
+		return minute >= QuietHours.Start && minute < QuietHours.End
+	}
+	return minute >= QuietHours.Start || minute < QuietHours.End
+}
@@ -0,0 +1,100 @@
+// redact.go contains the code which removes sensitive content from
+// items before they're submitted to a hook.
+//
+// Each feed may name fields which are always redacted, and patterns
+// whose matches are redacted from any field:
+//
+//    https://intranet.example.com/feed.rss = https://chat.example.com/hook
+//     - redact: author
+//     - redact-pattern: https?://[a-z.]*\.internal\S*
+//
+// Fields are named as in the JSON payload, and match at any depth, so
+// "email" redacts the email of the item's author(s).
+//
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// Redacted replaces the content which is redacted.
+const Redacted = "[redacted]"
+
+// redacting returns true if the given entry has any redaction rules.
+func redacting(entry RSSEntry) bool {
+	return len(entry.redactFields) > 0 || len(entry.redactPatterns) > 0
+}
+
+// redactText returns the given text with the matches of the redaction
+// patterns of the given entry replaced.
+func redactText(entry RSSEntry, text string) string {
+	for _, re := range entry.redactPatterns {
+		text = re.ReplaceAllString(text, Redacted)
+	}
+	return text
+}
+
+// redactValue redacts the given decoded JSON value, in place where
+// possible, returning the result.
+//
+// Every string within the value is replaced if all is set, otherwise
+// only the matches of the patterns within them are.
+func redactValue(entry RSSEntry, value interface{}, all bool) interface{} {
+	switch v := value.(type) {
+	case string:
+		if all {
+			return Redacted
+		}
+		return redactText(entry, v)
+	case []interface{}:
+		for i := range v {
+			v[i] = redactValue(entry, v[i], all)
+		}
+	case map[string]interface{}:
+		for key, field := range v {
+
+			// Parsed times must remain valid.
+			if strings.HasSuffix(key, "Parsed") {
+				continue
+			}
+			v[key] = redactValue(entry, field, all || entry.redactFields[key])
+		}
+	}
+	return value
+}
+
+// redactItem returns a copy of the given item, with the fields and
+// patterns which the given entry redacts replaced.
+//
+// The item is copied by way of its JSON representation, so that every
+// field, including any extensions, is covered.
+func redactItem(entry RSSEntry, item *gofeed.Item) (*gofeed.Item, error) {
+	if !redacting(entry) {
+		return item, nil
+	}
+
+	data, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	err = json.Unmarshal(data, &value)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = json.Marshal(redactValue(entry, value, false))
+	if err != nil {
+		return nil, err
+	}
+	redacted := &gofeed.Item{}
+	err = json.Unmarshal(data, redacted)
+	if err != nil {
+		return nil, err
+	}
+	return redacted, nil
+}
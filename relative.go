@@ -0,0 +1,100 @@
+// relative.go contains the code which resolves the relative URLs found
+// within feed-items, such as `/posts/123`, which a receiver couldn't
+// follow, into absolute URLs.
+//
+// URLs are resolved against the link of the feed, or its own URL if it
+// has none.  The option `resolve-links: link` resolves the link of each
+// item, and `resolve-links: all` also rewrites the links, and images,
+// within their description and content.
+//
+
+package main
+
+import (
+	"net/url"
+	"regexp"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// htmlURL matches the attributes of HTML elements which hold URLs.
+var htmlURL = regexp.MustCompile(`(?i)\b(href|src)\s*=\s*("[^"]*"|'[^']*')`)
+
+// feedBase returns the URL against which relative URLs within the given
+// feed, of the given entry, are resolved.
+func feedBase(entry RSSEntry, feed *gofeed.Feed) *url.URL {
+	base, err := url.Parse(entry.feed)
+	if err != nil {
+		return nil
+	}
+	if feed.Link != "" {
+		link, err := url.Parse(feed.Link)
+		if err == nil {
+			base = base.ResolveReference(link)
+		}
+	}
+	return base
+}
+
+// resolveURL returns the given URL resolved against the given base, and
+// whether it was relative.
+//
+// Fragments, such as `#comments`, refer to the item itself and are left
+// unchanged.
+func resolveURL(base *url.URL, ref string) (string, bool) {
+	if ref == "" || ref[0] == '#' {
+		return ref, false
+	}
+	u, err := url.Parse(ref)
+	if err != nil || u.IsAbs() {
+		return ref, false
+	}
+	return base.ResolveReference(u).String(), true
+}
+
+// resolveHTML returns the given HTML with the relative URLs of its links,
+// and images, resolved against the given base, along with the number of
+// URLs resolved.
+func resolveHTML(base *url.URL, html string) (string, int) {
+	count := 0
+	html = htmlURL.ReplaceAllStringFunc(html, func(attr string) string {
+		m := htmlURL.FindStringSubmatch(attr)
+		quote := m[2][:1]
+		ref := m[2][1 : len(m[2])-1]
+
+		resolved, ok := resolveURL(base, ref)
+		if !ok {
+			return attr
+		}
+		count++
+		return m[1] + "=" + quote + resolved + quote
+	})
+	return html, count
+}
+
+// resolveLinks resolves the relative URLs of the given feed's items, as
+// the resolve-links option of the given entry specifies.
+func resolveLinks(entry RSSEntry, feed *gofeed.Feed) {
+	if entry.resolveLinks == "" {
+		return
+	}
+	base := feedBase(entry, feed)
+	if base == nil {
+		return
+	}
+
+	for _, i := range feed.Items {
+		if link, ok := resolveURL(base, i.Link); ok {
+			debug("Resolved the relative link %s to %s\n", i.Link, link)
+			i.Link = link
+		}
+		if entry.resolveLinks == "all" {
+			var description, content int
+			i.Description, description = resolveHTML(base, i.Description)
+			i.Content, content = resolveHTML(base, i.Content)
+			if description+content > 0 {
+				debug("Resolved %d relative URLs within %s\n", description+content, itemName(i))
+			}
+		}
+	}
+}
@@ -9,18 +9,24 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
 	"crypto/sha1"
 	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"os"
 	"os/signal"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"syscall"
+	"text/template"
 	"time"
 
 	"github.com/mmcdole/gofeed"
@@ -33,25 +39,341 @@ type RSSEntry struct {
 	// The URL of the RSS/Atom feed
 	feed string
 
+	// The stable identifier of the feed, used in place of its URL when
+	// recording items as seen.
+	id string
+
+	// How items are identified when recording them as seen; by their
+	// "guid", the default, or their "link".
+	dedup string
+
+	// Set if tracking parameters should be removed from GUIDs which
+	// are URLs, before recording items as seen.
+	normalizeGUID bool
+
 	// The end-point to make the webhook request to.
 	hook string
+
+	// The template used to render the hook for each item, if the hook
+	// contains template-actions.
+	hookTemplate *template.Template
+
+	// The type of the hook; "http" by default.
+	hookType string
+
+	// The default priority of notifications, and the rules which
+	// override it for particular items.
+	priority      int
+	priorityRules []priorityRule
+
+	// The tags of notifications sent to ntfy.
+	tags string
+
+	// The application token used to authenticate with Gotify.
+	token string
+
+	// The routing-key, and severity, of alerts sent to PagerDuty.
+	routingKey string
+	severity   string
+
+	// The services notified via Apprise, as Apprise URLs.
+	appriseURLs string
+
+	// The sender, and comma-separated recipients, of items emailed via
+	// SMTP, and the format of their bodies; "text" or "html".
+	mailFrom   string
+	mailTo     string
+	mailFormat string
+
+	// Items linking to these domains are never notified.
+	deniedDomains []string
+
+	// Set if only items linking to the domain of the feed, or its
+	// subdomains, should be notified.
+	sameDomainOnly bool
+
+	// Items matching an exclude pattern are never notified, and if
+	// there are include patterns items must match one of them.
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+
+	// Items are only notified if they satisfy this expression, if set.
+	expression *itemExpr
+
+	// The timestamp treated as the canonical time of an item; one of
+	// "published", "updated", or "auto".
+	timestamp string
+
+	// Set if the article each item links to should be fetched, and
+	// its text included in the payload.
+	fullContent bool
+
+	// The maximum length of the description, and content, of items in
+	// payloads, overriding MaxBodyField unless negative.
+	maxBodyField int
+
+	// The timeout used when fetching the feed, overriding Timeout unless
+	// zero.
+	timeout time.Duration
+
+	// The timeout used when submitting items to the hook, overriding
+	// HookTimeout unless zero.
+	hookTimeout time.Duration
+
+	// The number of times a failed delivery to the hook is retried,
+	// overriding Retries unless negative.
+	retries int
+
+	// The period after an item is delivered during which it is never
+	// delivered again, overriding Cooldown unless negative.
+	cooldown time.Duration
+
+	// Set if items should be notified again whenever their content
+	// changes.
+	notifyOnChange bool
+
+	// The period for which a new item must remain in the feed,
+	// unchanged, before it is notified; zero to notify it at once.
+	settle time.Duration
+
+	// The status-codes which indicate a successful delivery to a
+	// webhook; any 2xx code if empty.
+	successCodes []string
+
+	// Set if items older than the newest item seen in the feed should
+	// never be notified.
+	monotonic bool
+
+	// The number of items, from the start of the feed, considered upon
+	// each poll; zero for all of them.
+	scanLimit int
+
+	// The fields of the JSON object posted to the hook, if limited.
+	fields map[string]bool
+
+	// The name of the part in which the JSON object is uploaded, as a
+	// file in a multipart form, along with the other fields of the form;
+	// the object is posted as the body if no name is set.
+	multipart  string
+	formFields []formField
+
+	// The compression applied to the body posted to the webhook; ""
+	// or "gzip".
+	compress string
+
+	// How relative URLs within items are resolved; "" to leave them,
+	// "link" to resolve the link of each item, or "all" to also resolve
+	// those within their description and content.
+	resolveLinks string
+
+	// How items without links are handled; "notify" by default, "skip",
+	// or "use-guid-as-link".
+	missingLink string
+
+	// The hook through which the JSON object is passed before it is
+	// posted to the hook, and how a failure of the transform is handled;
+	// "original" to post the original object, or "fail".
+	transformHook    string
+	transformFailure string
+
+	// The hook to which items are delivered if delivery to the hook
+	// fails.
+	fallbackHook string
+
+	// The parsers tried, in turn, if the feed can't be parsed, and the
+	// pattern used by the regex parser.
+	fallbackParsers []string
+	fallbackPattern *regexp.Regexp
+
+	// The hook to which the body of the feed is forwarded, as fetched,
+	// for archival.
+	archiveHook string
+
+	// The content-types accepted when fetching the feed, overriding
+	// DefaultContentTypes.
+	contentTypes []string
+
+	// The charset the feed is decoded from, overriding that it is
+	// served with.
+	charset string
+
+	// The Accept header sent when fetching the feed, overriding
+	// DefaultAccept.
+	accept string
+
+	// The credentials used to authenticate with the hook, via HTTP
+	// Basic authentication.
+	username string
+	password string
+
+	// The secret, named in SecretsFile, with which to authenticate with
+	// the hook, and the header it is sent in.
+	authSecret string
+	authHeader string
+
+	// The cookies sent when fetching the feed, for feeds which require
+	// a session.
+	cookies []*http.Cookie
+
+	// The method, and body, of the request made to fetch the feed; a
+	// GET without a body by default.
+	method string
+	body   string
+
+	// Set if the new items of each poll should be submitted to the
+	// hook together, as a single batch.
+	batch bool
+
+	// The options applied to the entry, as "key: value", in the order
+	// they were given.
+	options []string
+
+	// The template which renders the title of each item, and the
+	// prefix applied to it, if set.
+	titleTemplate *template.Template
+	titlePrefix   string
+
+	// The fields of items which are always redacted, and the patterns
+	// which are redacted from every field, before they're submitted.
+	redactFields   map[string]bool
+	redactPatterns []*regexp.Regexp
+
+	// Set if the entry was added via the admin API, rather than read
+	// from a configuration file.
+	admin bool
+
+	// Set if the global hook-base, and hook-suffix, should not be
+	// applied to the hook.
+	noHookBase bool
 }
 
 // Loaded contains the loaded feeds + hooks, as read from the specified
 // configuration file
 var Loaded []RSSEntry
 
+// LoadedLock guards Loaded, which may be changed via the admin API while
+// feeds are scanned.
+var LoadedLock sync.Mutex
+
+// ScanLock is held while feeds are scanned, so that a scan requested via
+// the admin API can't overlap a scheduled one.
+var ScanLock sync.Mutex
+
+// loadedEntries returns a copy of Loaded, which may be used while the
+// entries are changed.
+func loadedEntries() []RSSEntry {
+	LoadedLock.Lock()
+	defer LoadedLock.Unlock()
+
+	entries := make([]RSSEntry, len(Loaded))
+	copy(entries, Loaded)
+	return entries
+}
+
+// Deterministic is set if feeds should be scanned in a stable order,
+// sorted by their URL and hook, rather than in the order they were
+// configured, so that the output of each scan is reproducible.
+var Deterministic bool
+
 // Timeout is the (global) timeout we use when loading remote RSS
 // feeds.
 var Timeout time.Duration
 
-// loadConfig loads the named configuration file and populates our
-// `Loaded` list of RSS-feeds & Webhook addresses
-func loadConfig(filename string) {
+// DefaultAccept is the Accept header we send when fetching feeds.
+const DefaultAccept = "application/rss+xml, application/atom+xml, application/xml;q=0.9, text/xml;q=0.9, */*;q=0.8"
+
+// Separator divides the feed from the hook in each entry of the
+// configuration file.
+var Separator = "="
+
+// Comment begins a comment in the configuration file.
+var Comment = "#"
+
+// Verbose enables the logging of debug messages.
+var Verbose bool
+
+// Order controls the order in which the new items of a feed are
+// notified; either "feed", "oldest-first", or "global" to notify those
+// of every feed together, oldest first.
+var Order string
+
+// Retries is the number of times a failed delivery to a webhook is
+// retried immediately, rather than upon the next poll.
+var Retries int
+
+// RetryDelay is the delay before the first retry of a failed delivery,
+// which grows with each further retry.
+const RetryDelay = 2 * time.Second
+
+// NotifySlots limits the number of notifications which may be in
+// progress at once, if it is non-nil.
+var NotifySlots chan struct{}
+
+// debug logs the given message, if we're running verbosely.
+func debug(format string, args ...interface{}) {
+	if Verbose {
+		fmt.Printf(format, args...)
+	}
+}
+
+// itemName returns the name by which we log the given item; its link,
+// or its GUID if it has no link.
+func itemName(item *gofeed.Item) string {
+	if item.Link != "" {
+		return item.Link
+	}
+	return item.GUID
+}
+
+// configFiles holds the configuration files specified via -config,
+// which may be repeated.
+type configFiles []string
+
+// String returns the configuration files, comma-separated.
+func (c *configFiles) String() string {
+	return strings.Join(*c, ",")
+}
+
+// Set appends a configuration file to the list.
+func (c *configFiles) Set(value string) error {
+	*c = append(*c, value)
+	return nil
+}
+
+// loadConfigs loads each of the named configuration files, populating
+// our `Loaded` list of RSS-feeds & Webhook addresses.
+//
+// If the same feed and hook appear more than once only the first entry
+// is kept.  The global hook-base, and hook-suffix, are applied to the
+// hooks of the entries which are kept.
+func loadConfigs(filenames []string) {
+	seen := make(map[string]bool)
+
+	for _, filename := range filenames {
+		for _, entry := range loadConfig(filename) {
+			key := entry.feed + " " + entry.hook
+			if seen[key] {
+				fmt.Printf("Ignoring duplicate entry %s = %s in %s\n",
+					redactCredentials(entry.feed), entry.hook, filename)
+				continue
+			}
+			seen[key] = true
+
+			applyHookBase(&entry)
+			Loaded = append(Loaded, resolveOptions(entry))
+		}
+	}
+}
+
+// loadConfig loads the named configuration file and returns the list of
+// RSS-feeds & Webhook addresses it contains.
+func loadConfig(filename string) []RSSEntry {
+	var entries []RSSEntry
+
 	file, err := os.Open(filename)
 	if err != nil {
 		fmt.Printf("Error opening %s - %s\n", filename, err.Error())
-		return
+		return entries
 	}
 	defer file.Close()
 
@@ -65,245 +387,1380 @@ func loadConfig(filename string) {
 		tmp := scanner.Text()
 		tmp = strings.TrimSpace(tmp)
 
+		//
+		// Strip any trailing comment.  A "#" only starts a comment
+		// when it follows whitespace, so URL-fragments are kept.
+		//
+		comment := regexp.MustCompile(`\s+` + regexp.QuoteMeta(Comment) + `.*$`)
+		tmp = comment.ReplaceAllString(tmp, "")
+
+		//
+		// Lines beginning with "-" specify an option for the
+		// preceding entry.
+		//
+		if strings.HasPrefix(tmp, "-") {
+			if len(entries) == 0 {
+				fmt.Printf("Ignoring option without a feed - %s\n", tmp)
+				continue
+			}
+
+			err = parseOption(&entries[len(entries)-1], tmp)
+			if err != nil {
+				fmt.Printf("Error in %s - %s\n", filename, err.Error())
+			}
+			continue
+		}
+
 		//
 		// Skip lines that begin with a comment.
 		//
-		if (tmp != "") && (!strings.HasPrefix(tmp, "#")) {
+		if (tmp != "") && (!strings.HasPrefix(tmp, Comment)) {
 
 			//
 			// Otherwise find the feed + post-point
 			//
-			parser := regexp.MustCompile("^(.*)=([^=]+)")
-			match := parser.FindStringSubmatch(tmp)
+			feed, hook, ok := splitEntry(tmp)
 
 			//
 			// OK we found a suitable entry.
 			//
-			if len(match) == 3 {
-
-				feed := strings.TrimSpace(match[1])
-				hook := strings.TrimSpace(match[2])
+			if ok {
+				entry, err := newEntry(feed, hook)
+				if err != nil {
+					fmt.Printf("Error in %s - %s\n", filename, err.Error())
+					continue
+				}
 
 				// Append the new entry to our list
-				entry := RSSEntry{feed: feed, hook: hook}
-				Loaded = append(Loaded, entry)
+				entries = append(entries, entry)
 			}
 
 		}
 	}
 
+	// Drop any entries whose options are incomplete.
+	var valid []RSSEntry
+	for _, entry := range entries {
+		err := checkOptions(entry)
+		if err != nil {
+			fmt.Printf("Error in %s - ignoring %s - %s\n", filename, showEntry(entry), err.Error())
+			continue
+		}
+		valid = append(valid, entry)
+	}
+	return valid
+}
+
+// newEntry returns the entry for the given feed and hook, before any
+// options are applied.
+func newEntry(feed string, hook string) (RSSEntry, error) {
+
+	// Keep any credentials out of the hook, so that they're never
+	// shown.
+	hook, username, password := splitCredentials(hook)
+
+	entry := RSSEntry{feed: feed, hook: hook, hookType: "http",
+		username: username, password: password, maxBodyField: -1,
+		cooldown: -1, retries: -1}
+
+	// The hook might be a template.
+	if strings.Contains(hook, "{{") {
+		var err error
+		entry.hookTemplate, err = parseHookTemplate(hook)
+		if err != nil {
+			return entry, fmt.Errorf("invalid hook %s - %s", hook, err.Error())
+		}
+	}
+	return entry, nil
+}
+
+// splitEntry splits a line of the configuration file into the feed and
+// hook it contains, which are divided by our separator.
+//
+// Either might contain the separator, for example "=" within a query
+// string, so the first separator surrounded by whitespace is used.
+// Failing that the first separator followed by a URL is used, since a
+// hook is always a URL.
+func splitEntry(line string) (string, string, bool) {
+	spaced := regexp.MustCompile(`\s+` + regexp.QuoteMeta(Separator) + `\s+`)
+	if loc := spaced.FindStringIndex(line); loc != nil {
+		return strings.TrimSpace(line[:loc[0]]), strings.TrimSpace(line[loc[1]:]), true
+	}
+
+	scheme := regexp.MustCompile(`^\s*[a-zA-Z][a-zA-Z0-9+.-]*:`)
+	for i := 0; i < len(line); i++ {
+		if !strings.HasPrefix(line[i:], Separator) {
+			continue
+		}
+		rest := line[i+len(Separator):]
+		if i > 0 && scheme.MatchString(rest) {
+			return strings.TrimSpace(line[:i]), strings.TrimSpace(rest), true
+		}
+	}
+	return "", "", false
 }
 
-// fetchFeed fetches the contents of the specified URL.
-func fetchFeed(url string) (string, error) {
+// fetchFeed fetches the feed of the given entry, returning the body of
+// the response for the caller to read, and close.
+//
+// The body is not read here, so that large feeds may be parsed as they
+// are received rather than being held in memory in their entirety.
+//
+// The parser can fetch feeds itself, via its Client, but only with a
+// plain GET; it can't send our headers, cookies, or body, nor check
+// the content-type, or make conditional requests.  So feeds are fetched
+// here, with the same client and settings, and the body handed to it.
+//
+// If conditional is set, and conditional requests are enabled, the feed
+// is only fetched if it has changed.  Any error returned, other than
+// errNotModified, is a *FetchError.
+func fetchFeed(entry RSSEntry, conditional bool) (io.ReadCloser, error) {
 
-	// Ensure we setup a timeout for our fetch
-	client := &http.Client{Timeout: Timeout}
+	// Most feeds are fetched via GET, but query-style APIs might
+	// require a fixed body to be POSTed.
+	method := entry.method
+	if method == "" {
+		method = "GET"
+	}
+	var body io.Reader
+	if entry.body != "" {
+		body = strings.NewReader(entry.body)
+	}
 
-	// We'll only make a GET request
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequest(method, entry.feed, body)
 	if err != nil {
-		return "", err
+		return nil, &FetchError{Kind: FetchRequest, URL: entry.feed, Err: err}
+	}
+	if entry.body != "" {
+		req.Header.Set("Content-Type", "application/json")
 	}
 
 	// We ensure we identify ourself.
 	req.Header.Set("User-Agent", "rss2email (https://github.com/skx/rss2email)")
 
+	// Some servers return HTML unless we ask for a feed.
+	accept := entry.accept
+	if accept == "" {
+		accept = DefaultAccept
+	}
+	req.Header.Set("Accept", accept)
+
+	// Gated feeds may require a session cookie.
+	for _, cookie := range entry.cookies {
+		req.AddCookie(cookie)
+	}
+
+	// Only fetch the feed if it has changed, if we should.
+	conditional = conditional && ConditionalGet && method == "GET"
+	if conditional {
+		setValidators(entry, req)
+	}
+
 	// Make the request
-	resp, err := client.Do(req)
+	resp, err := fetchClient(entry).Do(req)
 	if err != nil {
-		return "", err
+		return nil, requestError(entry.feed, err)
+	}
+
+	if resp.StatusCode == http.StatusNotModified && conditional {
+		resp.Body.Close()
+		return nil, errNotModified
+	}
+
+	// An error-page is not a feed, so don't try to parse it.
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, &FetchError{Kind: FetchStatus, StatusCode: resp.StatusCode, URL: entry.feed}
 	}
-	defer resp.Body.Close()
 
-	// Read the body returned
-	output, err := ioutil.ReadAll(resp.Body)
+	// Nor is anything else which isn't of an acceptable type.
+	err = checkContentType(entry, resp.Header.Get("Content-Type"))
 	if err != nil {
-		return "", err
+		resp.Body.Close()
+		return nil, &FetchError{Kind: FetchContentType, StatusCode: resp.StatusCode, URL: entry.feed, Err: err}
+	}
+
+	if conditional {
+		rememberValidators(entry, resp)
+	}
+
+	// If the feed is archived we must read the body here, so that it
+	// may be both archived and parsed.
+	if entry.archiveHook != "" {
+		defer resp.Body.Close()
+
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, requestError(entry.feed, err)
+		}
+		archiveFeed(entry, data, resp.Header.Get("Content-Type"), time.Now())
+		return decodeBody(entry, resp, ioutil.NopCloser(bytes.NewReader(data)))
 	}
-	return string(output), nil
+
+	return decodeBody(entry, resp, resp.Body)
 }
 
-// isNew returns TRUE if this feed-item hasn't been notified about
-// previously.
-func isNew(parent string, item *gofeed.Item) bool {
+// decodeBody returns the given body, of the given response to a request
+// for the feed of the given entry, converted to UTF-8.
+func decodeBody(entry RSSEntry, resp *http.Response, body io.ReadCloser) (io.ReadCloser, error) {
+	decoded, err := decodeFeed(entry, resp.Header.Get("Content-Type"), body)
+	if err != nil {
+		return nil, &FetchError{Kind: FetchParse, StatusCode: resp.StatusCode, URL: entry.feed, Err: err}
+	}
+	return decoded, nil
+}
+
+// readFeed fetches the feed of the given entry, and parses its contents.
+//
+// If conditional is set the feed may be fetched conditionally, as with
+// fetchFeed.  Any error returned, other than errNotModified, is a
+// *FetchError.
+func readFeed(entry RSSEntry, conditional bool) (*gofeed.Feed, error) {
+
+	// Local feeds are read from the filesystem.
+	if isFileFeed(entry.feed) {
+		feed, err := readFileFeed(entry)
+		if err != nil {
+			return nil, err
+		}
+		fixLinks(entry, feed.Items)
+		resolveLinks(entry, feed)
+		return feed, nil
+	}
+
+	body, err := fetchFeed(entry, conditional)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var feed *gofeed.Feed
+	if len(entry.fallbackParsers) > 0 {
+		var data []byte
+		data, err = ioutil.ReadAll(body)
+		if err != nil {
+			return nil, requestError(entry.feed, err)
+		}
+		feed, err = parseWithFallback(entry, data)
+	} else {
+		feed, err = gofeed.NewParser().Parse(body)
+	}
+	if err != nil {
+		return nil, &FetchError{Kind: FetchParse, URL: entry.feed, Err: err}
+	}
+
+	fixLinks(entry, feed.Items)
+	resolveLinks(entry, feed)
+	return feed, nil
+}
+
+// seenDir returns the directory beneath which we record the items
+// we've already notified about.
+func seenDir() string {
+	return os.Getenv("HOME") + "/.rss2hook/seen"
+}
+
+// seenParent returns the key under which the items of the given entry
+// are recorded as seen; the feed's id if it has one, or its URL.
+func seenParent(entry RSSEntry) string {
+	if entry.id != "" {
+		return entry.id
+	}
+	return entry.feed
+}
+
+// seenKey returns the key under which we record that the given item,
+// of the given feed, has been seen.
+//
+// Items are identified by their GUID, or by their link if the feed's
+// dedup option is "link", with any tracking parameters removed if the
+// feed's normalize-guid option is set.
+func seenKey(entry RSSEntry, item *gofeed.Item) string {
+
+	id := item.GUID
+	if entry.dedup == "link" {
+		id = item.Link
+	}
+	if entry.normalizeGUID {
+		id = normalizeGUID(id)
+	}
 
 	hasher := sha1.New()
-	hasher.Write([]byte(parent))
-	hasher.Write([]byte(item.GUID))
+	hasher.Write([]byte(seenParent(entry)))
+	hasher.Write([]byte(id))
 	hashBytes := hasher.Sum(nil)
 
 	// Hexadecimal conversion
-	hexSha1 := hex.EncodeToString(hashBytes)
+	return hex.EncodeToString(hashBytes)
+}
 
-	if _, err := os.Stat(os.Getenv("HOME") + "/.rss2hook/seen/" + hexSha1); os.IsNotExist(err) {
+// isNew returns TRUE if this feed-item hasn't been notified about
+// previously.
+func isNew(entry RSSEntry, item *gofeed.Item) bool {
+
+	hexSha1 := seenKey(entry, item)
+
+	if _, err := os.Stat(seenDir() + "/" + hexSha1); os.IsNotExist(err) {
 		return true
 	}
 	return false
 }
 
 // recordSeen ensures that we won't re-announce a given feed-item.
-func recordSeen(parent string, item *gofeed.Item) {
+func recordSeen(entry RSSEntry, item *gofeed.Item) {
 
-	hasher := sha1.New()
-	hasher.Write([]byte(parent))
-	hasher.Write([]byte(item.GUID))
-	hashBytes := hasher.Sum(nil)
-
-	// Hexadecimal conversion
-	hexSha1 := hex.EncodeToString(hashBytes)
+	hexSha1 := seenKey(entry, item)
 
-	dir := os.Getenv("HOME") + "/.rss2hook/seen"
+	dir := seenDir()
 	os.MkdirAll(dir, os.ModePerm)
 
 	_ = ioutil.WriteFile(dir+"/"+hexSha1, []byte(item.Link), 0644)
 
-}
-
-// checkFeeds is our work-horse.
-//
-// For each available feed it looks for new entries, and when founds
-// triggers `notify` upon the resulting entry
-func checkFeeds() {
+	// Record the content of the item, if changes are notified.
+	if entry.notifyOnChange {
+		recordHash(entry, item)
+	}
 
-	//
-	// For each thing we're monitoring
-	//
-	for _, monitor := range Loaded {
+	// Advance the time of the newest item, if the feed is monotonic.
+	if entry.monotonic {
+		recordNewest(entry, item)
+	}
 
-		// Fetch the feed-contents
-		content, err := fetchFeed(monitor.feed)
+	// Track the order of the feed's keys, if we're to prune them.
+	if MaxKeysPerFeed > 0 {
+		trackSeenKey(seenParent(entry), hexSha1)
+	}
+}
 
-		if err != nil {
-			fmt.Printf("Error fetching %s - %s\n",
-				monitor.feed, err.Error())
-			continue
-		}
+// recordNotified records that the given item, of the given entry, has
+// been notified successfully.
+func recordNotified(entry RSSEntry, item *gofeed.Item) {
+	recordSeen(entry, item)
+	recordDelivery(entry, item)
+	recordRecent(entry, item)
+}
 
-		// Now parse the feed contents into a set of items
-		fp := gofeed.NewParser()
-		feed, err := fp.ParseString(content)
-		if err != nil {
-			fmt.Printf("Error parsing %s contents: %s\n", monitor.feed, err.Error())
-			continue
-		}
+// seenRecord describes an item we've recorded as seen.
+type seenRecord struct {
+	// The key of the item, as derived from its feed and GUID.
+	Key string `json:"key"`
 
-		// For each entry in the feed
-		for _, i := range feed.Items {
+	// The link of the item.
+	Link string `json:"link"`
 
-			// If we've not already notified about this one.
-			if isNew(monitor.feed, i) {
+	// The time the item was recorded.
+	Seen time.Time `json:"seen"`
+}
 
-				// Trigger the notification
-				err := notify(monitor.hook, i)
+// loadSeen returns all the items we've recorded as seen.
+func loadSeen() ([]seenRecord, error) {
+	files, err := ioutil.ReadDir(seenDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
 
-				// and if that notification succeeded
-				// then record this item as having been
-				// processed successfully.
-				if err == nil {
-					recordSeen(monitor.feed, i)
-				}
-			}
+	var records []seenRecord
+	for _, file := range files {
+		var link []byte
+		link, err = ioutil.ReadFile(seenDir() + "/" + file.Name())
+		if err != nil {
+			return nil, err
 		}
+		records = append(records, seenRecord{
+			Key:  file.Name(),
+			Link: string(link),
+			Seen: file.ModTime(),
+		})
 	}
+	return records, nil
 }
 
-// notify actually submits the specified item to the remote webhook.
+// storeSeen records the given item as seen, unless it already is.
 //
-// The RSS-item is submitted as a JSON-object.
-func notify(hook string, item *gofeed.Item) error {
+// It returns true if the record was stored.
+func storeSeen(record seenRecord) (bool, error) {
+	path := seenDir() + "/" + record.Key
+	if _, err := os.Stat(path); err == nil {
+		return false, nil
+	}
 
-	// We'll post the item as a JSON object.
-	// So first of all encode it.
-	jsonValue, err := json.Marshal(item)
+	err := os.MkdirAll(seenDir(), os.ModePerm)
 	if err != nil {
-		fmt.Printf("notify: Failed to encode JSON:%s\n", err.Error())
-		return err
+		return false, err
 	}
-
-	//
-	// Post to the specified hook URL.
-	//
-	res, err := http.Post(hook,
-		"application/json",
-		bytes.NewBuffer(jsonValue))
-
+	err = ioutil.WriteFile(path, []byte(record.Link), 0644)
 	if err != nil {
-		fmt.Printf("notify: Failed to POST to %s - %s\n",
-			hook, err.Error())
-		return err
+		return false, err
 	}
+	return true, os.Chtimes(path, record.Seen, record.Seen)
+}
 
-	//
-	// OK now we've submitted the post.
-	//
-	// We should retrieve the status-code + body, if the status-code
-	// is "odd" then we'll show them.
-	//
-	defer res.Body.Close()
-	_, err = ioutil.ReadAll(res.Body)
+// seenStats returns the number of items we've recorded as seen, along
+// with the total size of the state we hold for them.
+func seenStats() (int, int64, error) {
+	files, err := ioutil.ReadDir(seenDir())
 	if err != nil {
-		return err
+		if os.IsNotExist(err) {
+			return 0, 0, nil
+		}
+		return 0, 0, err
 	}
-	status := res.StatusCode
 
-	if status != 200 {
-		fmt.Printf("notify: Warning - Status code was not 200: %d\n", status)
+	var size int64
+	for _, file := range files {
+		size += file.Size()
 	}
-	return nil
+	return len(files), size, nil
 }
 
-// main is our entry-point
-func main() {
+// updateSeenMetrics records the size of our seen-state, so that the
+// growth of the state can be charted over time.
+func updateSeenMetrics() {
+	count, size, err := seenStats()
+	if err != nil {
+		fmt.Printf("Error reading %s - %s\n", seenDir(), err.Error())
+		return
+	}
 
-	// Parse the command-line flags
-	config := flag.String("config", "", "The path to the configuration-file to read")
-	timeout := flag.Duration("timeout", 5*time.Second, "The timeout used for fetching the remote feeds")
-	flag.Parse()
+	setMetric("rss2hook_seen_items", float64(count))
+	setMetric("rss2hook_seen_bytes", float64(size))
+	fmt.Printf("Seen-state holds %d items (%d bytes)\n", count, size)
+}
 
-	// Setup the default timeout.
-	Timeout = *timeout
+// startupDelay returns the time to wait before the first scan of feeds;
+// the given delay, plus a random duration up to the given jitter.
+func startupDelay(delay time.Duration, jitter time.Duration) time.Duration {
+	if jitter > 0 {
+		rand.Seed(time.Now().UnixNano())
+		delay += time.Duration(rand.Int63n(int64(jitter)))
+	}
+	return delay
+}
 
-	if *config == "" {
-		fmt.Printf("Please specify a configuration-file to read\n")
-		return
+// oldestFirst returns the given items sorted by their canonical time,
+// oldest first.
+//
+// If any item lacks a timestamp the items are returned in the order in
+// which they appeared in the feed.
+func oldestFirst(entry RSSEntry, items []*gofeed.Item) []*gofeed.Item {
+	if !allTimed(entry, items) {
+		return items
 	}
 
-	//
-	// Load the configuration file
-	//
-	loadConfig(*config)
+	sorted := make([]*gofeed.Item, len(items))
+	copy(sorted, items)
+	sort.SliceStable(sorted, func(a, b int) bool {
+		return itemTime(entry, sorted[a]).Before(*itemTime(entry, sorted[b]))
+	})
+	return sorted
+}
 
-	//
-	// Show the things we're monitoring
-	//
-	for _, ent := range Loaded {
-		fmt.Printf("Monitoring feed %s\nPosting to %s\n\n",
-			ent.feed, ent.hook)
+// allTimed returns true if every one of the given items, of the given
+// entry, has a timestamp.
+func allTimed(entry RSSEntry, items []*gofeed.Item) bool {
+	for _, i := range items {
+		if itemTime(entry, i) == nil {
+			return false
+		}
 	}
+	return true
+}
+
+// anyNew returns true if any of the given items, of the given entry,
+// haven't been seen, or have changed since.
+func anyNew(entry RSSEntry, items []*gofeed.Item) bool {
+	for _, i := range items {
+		if needsNotify(entry, i) {
+			return true
+		}
+	}
+	return false
+}
+
+// uniqueItems returns the given items with any duplicates removed; items
+// are duplicates if they share the same seen-key.
+//
+// Some feeds repeat items, and as an item is only recorded as seen
+// after it has been notified, each copy would otherwise be notified.
+func uniqueItems(entry RSSEntry, items []*gofeed.Item) []*gofeed.Item {
+	var unique []*gofeed.Item
+	seen := make(map[string]bool)
+
+	for _, i := range items {
+		key := seenKey(entry, i)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, i)
+	}
+	return unique
+}
+
+// checkFeeds is our work-horse.
+//
+// For each available feed it looks for new entries, and when founds
+// triggers `notify` upon the resulting entry
+func checkFeeds() {
+	ScanLock.Lock()
+	defer ScanLock.Unlock()
+
+	// Are we within quiet hours?
+	quiet := inQuietHours(time.Now())
 
 	//
-	// Make the initial scan of feeds immediately to avoid waiting too
-	// long for the first time.
+	// For each thing we're monitoring, in a stable order if we should
+	// be reproducible.
+	//
+	startSummary()
+	entries := loadedEntries()
+	if Deterministic {
+		sort.SliceStable(entries, func(a, b int) bool {
+			if entries[a].feed != entries[b].feed {
+				return entries[a].feed < entries[b].feed
+			}
+			return entries[a].hook < entries[b].hook
+		})
+	}
+	for _, monitor := range entries {
+		if stopping() {
+			break
+		}
+		checkFeed(monitor, quiet)
+	}
+	notifyHeld()
+	sendSummary()
+	pruneValidators()
+}
+
+// checkFeed looks for new entries in the feed of the given entry, and
+// notifies them; unless we're within quiet hours.
+//
+// The caller must hold ScanLock.
+func checkFeed(monitor RSSEntry, quiet bool) {
+
+	// Skip feeds which have been paused.
+	state := loadFeedState(monitor.feed)
+	if time.Now().Before(state.PausedUntil) {
+		fmt.Printf("Skipping %s - paused until %s\n",
+			redactCredentials(monitor.feed), state.PausedUntil.Format(time.RFC3339))
+		return
+	}
+
+	// Skip feeds which failed to parse recently.
+	if parseBackingOff(monitor.feed) {
+		return
+	}
+
+	// Fetch the feed, and parse it into a set of items
+	feed, err := readFeed(monitor, true)
+	summarizeRead(monitor, feed, err)
+	if err == errNotModified {
+		debug("Skipping %s - not modified\n", redactCredentials(monitor.feed))
+		checkFreshness(monitor.feed, false)
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error reading %s - %s\n",
+			redactCredentials(monitor.feed), err.Error())
+		if fe, ok := err.(*FetchError); ok {
+			addMetric(metricName("rss2hook_fetch_errors_total", "kind", fe.Kind), 1)
+			if fe.Kind == FetchParse {
+				recordParse(monitor.feed, false)
+			}
+		}
+		checkFreshness(monitor.feed, false)
+		return
+	}
+	recordParse(monitor.feed, true)
+
+	// Only consider the first items of huge feeds, if we should.
+	if monitor.scanLimit > 0 && len(feed.Items) > monitor.scanLimit {
+		debug("Considering only the first %d of the %d items of %s\n",
+			monitor.scanLimit, len(feed.Items), redactCredentials(monitor.feed))
+		feed.Items = feed.Items[:monitor.scanLimit]
+	}
+
+	// Remove duplicate entries, and sort them if we should.
+	items := uniqueItems(monitor, feed.Items)
+	if Order == "oldest-first" {
+		items = oldestFirst(monitor, items)
+	}
+
+	// Warn if the feed appears to have changed its GUIDs.
+	checkGUIDs(monitor, items)
+
+	// The first poll of a feed may notify only some items.
+	if firstRun(monitor, items) {
+		items = applyFirstRun(monitor, items)
+	}
+
+	// For each entry in the feed
+	produced := false
+	skipped := len(feed.Items) - len(items)
+	var newest time.Time
+	if monitor.monotonic {
+		newest = newestSeen(monitor)
+	}
+	var pending []*gofeed.Item
+	for _, i := range items {
+
+		// Deliver nothing further once we're shutting down; the
+		// remaining items will be found again upon restart.
+		if stopping() {
+			return
+		}
+
+		// Count those we've already seen, unless they've
+		// changed and should be notified again.
+		if !needsNotify(monitor, i) {
+			skipped++
+			continue
+		}
+
+		produced = true
+
+		// Items older than the newest we've seen
+		// are resurfacing, so aren't notified.
+		if monitor.monotonic && olderThan(monitor, i, newest) {
+			debug("Suppressing %s - older than the newest item seen\n", itemName(i))
+			recordSeen(monitor, i)
+			continue
+		}
+
+		// Items which are filtered out are
+		// recorded, but not notified.
+		if ok, reason := checkFilters(monitor, i); !ok {
+			debug("Suppressing %s - %s\n", itemName(i), reason)
+			recordSeen(monitor, i)
+			continue
+		}
+
+		// Items which flap in and out of the
+		// feed are only notified once.
+		if coolingDown(monitor, i) {
+			debug("Suppressing %s - delivered within cooldown\n", itemName(i))
+			recordSeen(monitor, i)
+			continue
+		}
+
+		// Items which might yet be edited, or deleted,
+		// are held until they've settled.
+		if settling(monitor, i) {
+			debug("Deferring %s - settling\n", itemName(i))
+			continue
+		}
+
+		if i.Link == "" {
+			debug("Notifying %s without a link\n", i.GUID)
+		}
+
+		// During quiet hours items are deferred,
+		// by leaving them unseen, or suppressed.
+		if quiet {
+			if QuietHours.Mode == "suppress" {
+				debug("Suppressing %s - quiet hours\n", itemName(i))
+				recordSeen(monitor, i)
+			} else {
+				debug("Deferring %s - quiet hours\n", itemName(i))
+			}
+			continue
+		}
+
+		// Batched items are notified together, below.
+		if batched(monitor) {
+			pending = append(pending, i)
+			continue
+		}
+
+		// Items of every feed are notified together,
+		// once all have been polled.
+		if Order == "global" {
+			holdItem(monitor, i)
+			continue
+		}
+
+		// Trigger the notification
+		err := notify(monitor, i)
+		summarizeNotify(monitor, 1, err)
+
+		// and if that notification succeeded
+		// then record this item as having been
+		// processed successfully.
+		if err == nil {
+			recordNotified(monitor, i)
+		}
+	}
+
+	// Notify any batched items, and record them if that
+	// succeeded.
+	if len(pending) > 0 && !stopping() {
+		err := notifyBatch(monitor, feed, pending)
+		summarizeNotify(monitor, len(pending), err)
+		if err == nil {
+			for _, i := range pending {
+				recordNotified(monitor, i)
+			}
+		}
+	}
+
+	// Record how many items dedup skipped, a feed which
+	// skips few may be changing its GUIDs.
+	debug("Skipped %d of the %d items of %s as duplicates, or already seen\n",
+		skipped, len(feed.Items), redactCredentials(monitor.feed))
+	setMetric(metricName("rss2hook_feed_items", "feed", redactCredentials(monitor.feed)), float64(len(feed.Items)))
+	setMetric(metricName("rss2hook_feed_items_skipped", "feed", redactCredentials(monitor.feed)), float64(skipped))
+	addMetric(metricName("rss2hook_items_skipped_total", "feed", redactCredentials(monitor.feed)), float64(skipped))
+
+	rememberLinks(monitor, items)
+	if MaxKeysPerFeed > 0 {
+		pruneSeenKeys(monitor, items)
+	}
+	if monitor.settle > 0 {
+		prunePending(monitor, items)
+	}
+	if monitor.notifyOnChange {
+		updateHashes(monitor, items)
+	}
+	if ConditionalGet {
+		keepValidators(monitor, !anyNew(monitor, items))
+	}
+	checkFreshness(monitor.feed, produced)
+}
+
+// notify actually submits the specified item to the remote webhook, or
+// its fallback hook if that fails.
+func notify(entry RSSEntry, item *gofeed.Item) error {
+	return withFallback(entry, func(e RSSEntry) error {
+		return notifyHook(e, item)
+	})
+}
+
+// notifyHook submits the specified item to the webhook of the given
+// entry.
+//
+// The RSS-item is submitted as a JSON-object, along with the fields
+// computed by `newPayload`, unless the hook is of a different type.
+func notifyHook(entry RSSEntry, item *gofeed.Item) error {
+
+	// Wait for a free slot, if notifications are limited.
+	if NotifySlots != nil {
+		NotifySlots <- struct{}{}
+		defer func() { <-NotifySlots }()
+	}
+
+	// The priority is that of the item as published, before anything
+	// is removed, or its title rewritten.
+	priority := itemPriority(entry, item)
+
+	// Remove anything we shouldn't submit.
+	item, err := redactItem(entry, item)
+	if err != nil {
+		fmt.Printf("notify: Failed to redact item:%s\n", err.Error())
+		return err
+	}
+	item, err = retitleItem(entry, item)
+	if err != nil {
+		fmt.Printf("notify: Failed to render title:%s\n", err.Error())
+		return err
+	}
+
+	switch entry.hookType {
+	case "ntfy":
+		return notifyNtfy(entry, item, priority)
+	case "gotify":
+		return notifyGotify(entry, item, priority)
+	case "pagerduty":
+		return notifyPagerDuty(entry, item)
+	case "teams":
+		return notifyTeams(entry, item)
+	case "apprise":
+		return notifyApprise(entry, item, priority)
+	case "smtp":
+		return notifySMTP(entry, item)
+	}
+
+	// We'll post the item as a JSON object.
+	// So first of all encode it.
+	payload := newPayload(entry, item, priority)
+	jsonValue, err := json.Marshal(payload)
+	if err == nil {
+		jsonValue, err = trimPayload(entry, jsonValue)
+	}
+	if err != nil {
+		fmt.Printf("notify: Failed to encode JSON:%s\n", err.Error())
+		return err
+	}
+
+	// Pass it through the transform hook, if there is one.
+	jsonValue, err = transformPayload(entry, jsonValue)
+	if err != nil {
+		return err
+	}
+
+	//
+	// Find the hook URL to post to.
 	//
-	checkFeeds()
+	url := entry.hook
+	if !isAWSHook(entry.hook) {
+		url, err = hookURL(entry, payload)
+		if err != nil {
+			fmt.Printf("notify: Failed to render hook %s - %s\n", entry.hook, err.Error())
+			return err
+		}
+	}
+
+	return postJSON(entry, url, jsonValue)
+}
+
+// postJSON submits the given JSON object to the specified hook URL of
+// the given entry.
+func postJSON(entry RSSEntry, url string, jsonValue []byte) error {
 
 	//
-	// Now repeat that every five minutes.
+	// If we're writing our payloads to disk, rather than submitting
+	// them, then do so before they're compressed.
 	//
-	c := cron.New()
-	c.AddFunc("@every 5m", func() { checkFeeds() })
-	c.Start()
+	if OutputDir != "" {
+		return writeOutput(url, "application/json", jsonValue)
+	}
+
+	//
+	// If the hook is an SNS topic, or SQS queue, publish there.
+	//
+	if isAWSHook(entry.hook) {
+		err := notifyAWS(entry.hook, jsonValue)
+		if err != nil {
+			fmt.Printf("notify: Failed to publish to %s - %s\n",
+				entry.hook, err.Error())
+		}
+		return err
+	}
+
+	//
+	// Upload the object as a file, if we should.
+	//
+	body := jsonValue
+	contentType := "application/json"
+	if entry.multipart != "" {
+		var err error
+		body, contentType, err = multipartBody(entry, jsonValue)
+		if err != nil {
+			return err
+		}
+	}
+
+	//
+	// Compress the body, if we should.
+	//
+	encoding := ""
+	if entry.compress == "gzip" {
+		var err error
+		body, err = gzipBody(body)
+		if err != nil {
+			return err
+		}
+		encoding = "gzip"
+	}
+
+	//
+	// Post to the specified hook URL.
+	//
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	err = setHookAuth(entry, req)
+	if err != nil {
+		return err
+	}
+
+	return deliver(entry, req, acceptStatus(entry))
+}
+
+// gzipBody returns the given data compressed with gzip.
+func gzipBody(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// deliver makes the given request to a webhook, on behalf of the given
+// entry, retrying it as many times as the entry allows if it fails.
+//
+// The check function is given the status-code and body of the response,
+// and may reject the delivery by returning an error.  If no function is
+// supplied any 2xx status-code is accepted.
+func deliver(entry RSSEntry, req *http.Request, check func(int, []byte) error) error {
+
+	if OutputDir != "" {
+		return writeRequest(req)
+	}
+
+	if check == nil {
+		check = acceptStatus(RSSEntry{})
+	}
+
+	client := hookClient(entry)
+	return retry(entry, req.URL.Host, func(attempt int) error {
+
+		// The body must be read afresh for each attempt.
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return err
+			}
+			req.Body = body
+		}
+		return deliverOnce(client, req, check)
+	})
+}
+
+// retry calls the given function to make a delivery to the named
+// destination, on behalf of the given entry, calling it again as many
+// times as the entry allows if it fails.
+//
+// The function is given the number of the attempt, zero for the first.
+func retry(entry RSSEntry, destination string, send func(int) error) error {
+	err := send(0)
+	for attempt := 1; err != nil && attempt <= entry.retries && !stopping(); attempt++ {
+		debug("Retrying delivery to %s, attempt %d of %d\n",
+			destination, attempt, entry.retries)
+		time.Sleep(time.Duration(attempt) * RetryDelay)
+		err = send(attempt)
+	}
+	return err
+}
+
+// deliverOnce makes the given request to a webhook, with the given
+// client, and checks the response as described for deliver.
+func deliverOnce(client *http.Client, req *http.Request, check func(int, []byte) error) error {
+
+	// Honour any delay the hook requested, and our own limits.
+	waitForHook(req.URL.Host)
+	release := acquireHook(req.URL)
+	defer release()
+
+	res, err := client.Do(req)
+	if err != nil {
+		fmt.Printf("notify: Failed to POST to %s - %s\n",
+			req.URL, err.Error())
+		return err
+	}
+	recordHookDelay(req.URL.Host, res)
+
+	//
+	// OK now we've submitted the post.
+	//
+	// We should retrieve the status-code + body, if the status-code
+	// is "odd" then the delivery failed, and the item must not be
+	// recorded as seen.
+	//
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	err = check(res.StatusCode, body)
+	if err != nil {
+		fmt.Printf("notify: %s rejected the item - %s\n",
+			req.URL.Host, err.Error())
+	}
+	return err
+}
+
+// main is our entry-point
+func main() {
+
+	// Parse the command-line flags
+	var configs configFiles
+	flag.Var(&configs, "config", "The path to the configuration-file to read, may be repeated")
+	flag.StringVar(&Separator, "separator", "=", "The separator between the feed and the hook in the configuration file, e.g. \"->\"")
+	flag.StringVar(&Comment, "comment", "#", "The character which begins a comment in the configuration file")
+	timeout := flag.Duration("timeout", 5*time.Second, "The timeout used for fetching the remote feeds")
+	flag.DurationVar(&HookTimeout, "hook-timeout", 0, "The timeout used for submitting items to webhooks, zero for none")
+	flag.IntVar(&Retries, "retries", 0, "The number of times a failed delivery to a webhook is retried, before the item is left for the next poll")
+	flag.StringVar(&FileRoot, "file-root", "", "The directory beneath which local feeds, given as file:// URLs, may be read")
+	flag.StringVar(&HookBase, "hook-base", "", "A prefix applied to every hook URL, which is URL-escaped if the prefix ends with \"=\"")
+	flag.StringVar(&HookSuffix, "hook-suffix", "", "A suffix applied to every hook URL")
+	flag.StringVar(&SecretsFile, "secrets-file", "", "A file of named secrets, one 'name = value' per line, referenced by the auth-secret option; reloaded upon SIGHUP")
+	flag.StringVar(&SummaryHook, "summary-hook", "", "A hook to which a summary of each poll of the feeds is posted, as JSON")
+	flag.StringVar(&DelayHeader, "delay-header", "", "A header, e.g. X-Retry-After, in which hooks may request a delay before their next delivery")
+	flag.IntVar(&HookRate, "hook-rate", 0, "The maximum number of deliveries to each hook per minute, however many feeds share it, zero for no limit")
+	flag.IntVar(&HookConcurrency, "hook-concurrency", 0, "The maximum number of deliveries in progress to each hook at once, zero for no limit")
+	notifyConcurrency := flag.Int("notify-concurrency", 0, "The maximum number of notifications in progress at once, zero for no limit")
+	quietHours := flag.String("quiet-hours", "", "A daily window during which items are not notified, e.g. 22:00-07:00")
+	quietZone := flag.String("quiet-timezone", "", "The timezone of -quiet-hours, e.g. Europe/London, by default the local timezone")
+	quietMode := flag.String("quiet-mode", "defer", "How items are handled during -quiet-hours; \"defer\" notifies them once the window ends, \"suppress\" never notifies them")
+	flag.IntVar(&MaxIdleConns, "max-idle-conns", 100, "The maximum number of idle connections kept open, across all hosts")
+	flag.IntVar(&MaxIdleConnsPerHost, "max-idle-conns-per-host", 10, "The maximum number of idle connections kept open to a single host")
+	flag.IntVar(&MaxConnsPerHost, "max-conns-per-host", 0, "The maximum number of connections open to a single host, zero for no limit")
+	flag.DurationVar(&IdleConnTimeout, "idle-conn-timeout", 90*time.Second, "The time after which an idle connection is closed, zero for never")
+	flag.BoolVar(&HookHTTP2, "hook-http2", true, "Negotiate HTTP/2 with webhooks which support it, -hook-http2=false for servers which mishandle it")
+	flag.BoolVar(&SharedTransport, "shared-transport", false, "Fetch feeds, and submit items to webhooks, via the same pool of connections")
+	flag.IntVar(&MaxBodyField, "max-body-field", 0, "The maximum length of the description, and content, of items posted to hooks, zero for no limit")
+	flag.IntVar(&MaxKeysPerFeed, "max-keys-per-feed", 0, "The maximum number of seen-keys retained for each feed, the oldest are pruned, zero for no limit")
+	flag.DurationVar(&Cooldown, "cooldown", 0, "Never deliver an item again within this duration of its last delivery, even if it reappears as new, e.g. 24h")
+	flag.DurationVar(&ParseBackoff, "parse-backoff", 0, "Retry feeds which fail to parse after this interval, doubled for each further failure, rather than upon every poll, e.g. 10m")
+	flag.DurationVar(&ParseBackoffMax, "parse-backoff-max", 24*time.Hour, "The longest interval after which a feed which fails to parse is retried")
+	flag.BoolVar(&ConditionalGet, "conditional-get", false, "Fetch feeds with conditional requests, so that those which haven't changed aren't downloaded again")
+	flag.DurationVar(&ForceRefresh, "force-refresh", 24*time.Hour, "Fetch feeds in full after this interval, regardless of -conditional-get, in case their servers mishandle caching, zero for never")
+	flag.DurationVar(&ValidatorTTL, "validator-ttl", 30*24*time.Hour, "Discard the validators of feeds not fetched in full within this duration, zero to keep them while the feed is configured")
+	flag.DurationVar(&StaleAfter, "stale-after", 0, "Report feeds which have produced no new items for this duration as stale, e.g. 720h")
+	startDelay := flag.Duration("startup-delay", 0, "The time to wait before the first scan of feeds, e.g. 30s")
+	startJitter := flag.Duration("startup-jitter", 0, "A random duration, up to this long, added to -startup-delay")
+	flag.DurationVar(&ShutdownGrace, "shutdown-grace", 30*time.Second, "The longest to wait, upon shutdown, for the delivery in progress to finish")
+	lease := flag.String("lease", "", "A lease-file, shared by replicas, so that only the instance holding it polls feeds")
+	adminAddr := flag.String("admin-addr", "", "The address to serve the admin API upon, e.g. 127.0.0.1:9092")
+	adminToken := flag.String("admin-token", os.Getenv("RSS2HOOK_ADMIN_TOKEN"), "The token required by the admin API, by default $RSS2HOOK_ADMIN_TOKEN")
+	once := flag.Bool("once", false, "Poll the feeds once, notifying any new items, and exit")
+	flag.StringVar(&Pushgateway, "pushgateway", "", "The URL of a Prometheus Pushgateway to which the metrics of a -once run are pushed")
+	flag.StringVar(&PushJob, "pushgateway-job", "rss2hook", "The job label under which metrics are pushed to the Pushgateway")
+	metricsAddr := flag.String("metrics", "", "The address to serve metrics upon, e.g. 127.0.0.1:9090")
+	aggregateAddr := flag.String("aggregate-addr", "", "The address to serve a JSON Feed of recently notified items upon, e.g. 127.0.0.1:9091")
+	firstRunPolicy := flag.String("first-run", "all", "The items notified the first time a feed is polled; \"all\", \"seed\" to notify none, or \"latest:N\" to notify the N newest")
+	order := flag.String("order", "feed", "The order in which to notify new items; \"feed\", \"oldest-first\", or \"global\" to notify those of every feed together")
+	denied := flag.String("deny-domains", "", "A comma-separated list of domains whose items are never notified")
+	flag.BoolVar(&Deterministic, "deterministic", false, "Scan feeds in a stable order, sorted by URL and hook, for reproducible output")
+	flag.BoolVar(&Verbose, "verbose", false, "Show debug messages")
+	flag.StringVar(&OutputDir, "output-dir", "", "Write the payloads which would be submitted to hooks into files within this directory, rather than submitting them")
+	flag.BoolVar(&TraceHooks, "trace-hooks", false, "Log the requests sent to hooks, and their responses, which may include sensitive content")
+	replay := flag.String("replay", "", "Send the items of the given feed, published within the duration given as the next argument, to its hooks")
+	list := flag.Bool("list", false, "Show each feed, and the settings in effect for it, and exit")
+	printConfig := flag.Bool("print-effective-config", false, "Show the configuration in effect, with secrets redacted, as JSON, and exit")
+	testFilter := flag.String("test-filter", "", "Show whether each current item of the given feed passes its filters, and why, and exit")
+	markSeenFeed := flag.String("mark-seen", "", "Record every current item of the given feed as seen, without notifying them, and exit")
+	probe := flag.Bool("probe-hooks", false, "Probe each distinct hook, reporting whether it is reachable and its status, and exit")
+	probeMethod := flag.String("probe-method", "OPTIONS", "The method used to probe hooks with -probe-hooks")
+	preflightChecks := flag.Bool("preflight", false, "Check the state directory is writable, and the hooks reachable, before starting")
+	stats := flag.Bool("stats", false, "Show statistics of the seen-state, and of the feeds of any configuration files given, and exit")
+	exportSeen := flag.String("export-seen", "", "Export the seen-state, as JSON, to the given file and exit")
+	importSeen := flag.String("import-seen", "", "Merge the seen-state from the given JSON file, as written by -export-seen, and exit")
+	diff := flag.String("diff", "", "Show the feeds added, removed, or changed, between the given configuration file and the one given as the next argument, and exit")
+	pause := flag.String("pause", "", "Pause polling of the given feed, for the duration given as the next argument")
+	flag.Parse()
+
+	// Setup the default timeout, and the clients which use it.
+	Timeout = *timeout
+	setupClients()
+
+	// Keep any credentials of the gateway out of the hook-base.
+	setupHookBase()
+	if TraceHooks {
+		fmt.Printf("WARNING: -trace-hooks logs the content sent to, and returned by, hooks, which may be sensitive\n")
+	}
+
+	// Setup the limit on concurrent notifications.
+	if *notifyConcurrency > 0 {
+		NotifySlots = make(chan struct{}, *notifyConcurrency)
+	}
+
+	// Setup the order in which to notify items.
+	if *order != "feed" && *order != "oldest-first" && *order != "global" {
+		fmt.Printf("Unknown order %s - use \"feed\", \"oldest-first\", or \"global\"\n", *order)
+		return
+	}
+	Order = *order
+
+	// Setup the policy for the first poll of each feed.
+	err := setupFirstRun(*firstRunPolicy)
+	if err != nil {
+		fmt.Printf("Error in -first-run - %s\n", err.Error())
+		return
+	}
+
+	// Setup our quiet hours, if any.
+	if *quietHours != "" {
+		err := setupQuietHours(*quietHours, *quietZone, *quietMode)
+		if err != nil {
+			fmt.Printf("Error in -quiet-hours - %s\n", err.Error())
+			return
+		}
+	}
+
+	// Setup the domains we never notify about.
+	DeniedDomains = parseDomains(*denied)
+
+	//
+	// If we're exporting, or importing, our state then do so and exit.
+	//
+	if *exportSeen != "" {
+		exportSeenState(*exportSeen)
+		return
+	}
+	if *importSeen != "" {
+		importSeenState(*importSeen)
+		return
+	}
+
+	//
+	// If we're comparing configuration files then do so, and exit.
+	//
+	if *diff != "" {
+		if flag.NArg() != 1 {
+			fmt.Printf("Usage: rss2hook -diff <old.cfg> <new.cfg>\n")
+			return
+		}
+		diffConfigs(*diff, flag.Arg(0))
+		return
+	}
+
+	//
+	// If we're pausing a feed then do so, and exit.
+	//
+	if *pause != "" {
+		duration, err := time.ParseDuration(flag.Arg(0))
+		if err != nil {
+			fmt.Printf("Usage: rss2hook -pause <feed> <duration>\n")
+			return
+		}
+		err = pauseFeed(*pause, duration)
+		if err != nil {
+			fmt.Printf("Error pausing %s - %s\n", redactCredentials(*pause), err.Error())
+			return
+		}
+		fmt.Printf("Paused %s until %s\n", redactCredentials(*pause),
+			time.Now().Add(duration).Format(time.RFC3339))
+		return
+	}
+
+	//
+	// If we're showing statistics then do so, and exit; the
+	// configuration is optional.
+	//
+	if *stats {
+		loadConfigs(configs)
+		loadAdminFeeds()
+		showStats()
+		return
+	}
+
+	if len(configs) == 0 {
+		fmt.Printf("Please specify a configuration-file to read\n")
+		return
+	}
+
+	//
+	// Load the configuration files
+	//
+	loadConfigs(configs)
+	loadAdminFeeds()
+
+	err = loadSecrets()
+	if err != nil {
+		fmt.Printf("Error reading secrets - %s\n", err.Error())
+		return
+	}
 
 	//
-	// Now we can loop waiting to be terminated via ctrl-c, etc.
+	// If we're listing our feeds then do so, and exit.
+	//
+	if *list {
+		listFeeds()
+		return
+	}
+
+	//
+	// If we're showing the effective configuration then do so, and exit.
+	//
+	if *printConfig {
+		printEffectiveConfig()
+		return
+	}
+
+	//
+	// If we're replaying a feed then do so, and exit.
+	//
+	if *replay != "" {
+		duration, err := time.ParseDuration(flag.Arg(0))
+		if err != nil {
+			fmt.Printf("Usage: rss2hook -config <file> -replay <feed> <duration>\n")
+			return
+		}
+		replayFeed(*replay, duration)
+		return
+	}
+
+	//
+	// If we're testing the filters of a feed then do so, and exit.
+	//
+	if *testFilter != "" {
+		testFilters(*testFilter)
+		return
+	}
+
+	//
+	// If we're marking a feed as seen then do so, and exit.
+	//
+	if *markSeenFeed != "" {
+		markSeen(*markSeenFeed)
+		return
+	}
+
+	//
+	// If we're probing our hooks then do so, and exit.
+	//
+	if *probe {
+		if !probeHooks(strings.ToUpper(*probeMethod)) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	//
+	// Run our startup checks, if we should.
+	//
+	if *preflightChecks && !preflight() {
+		fmt.Printf("Preflight checks failed\n")
+		os.Exit(1)
+	}
+
+	//
+	// Show the configuration we're running, and the things we're
+	// monitoring.
+	//
+	hash := configHash(Loaded)
+	fmt.Printf("Configuration hash %s\n\n", hash)
+	setMetric(metricName("rss2hook_config_info", "hash", hash), 1)
+
+	for _, ent := range Loaded {
+		fmt.Printf("Monitoring feed %s\nPosting to %s\n",
+			redactCredentials(ent.feed), ent.hook)
+
+		state := loadFeedState(ent.feed)
+		if time.Now().Before(state.PausedUntil) {
+			fmt.Printf("Paused until %s\n",
+				state.PausedUntil.Format(time.RFC3339))
+		}
+		fmt.Printf("\n")
+	}
+
+	//
+	// Serve metrics, if we should.
+	//
+	if *metricsAddr != "" {
+		serveMetrics(*metricsAddr)
+	}
+	if *aggregateAddr != "" {
+		serveAggregate(*aggregateAddr)
+	}
+	if *adminAddr != "" {
+		if *adminToken == "" {
+			fmt.Printf("The admin API requires a token, via -admin-token or $RSS2HOOK_ADMIN_TOKEN\n")
+			return
+		}
+		serveAdmin(*adminAddr, *adminToken)
+	}
+	updateSeenMetrics()
+
+	//
+	// If we're one of several replicas wait until we're the leader.
+	//
+	if *lease != "" {
+		acquireLease(*lease)
+	}
+
+	//
+	// Wait before the initial scan, if we should, so that replicas
+	// restarted together don't all fetch every feed at once.
+	//
+	if delay := startupDelay(*startDelay, *startJitter); delay > 0 {
+		fmt.Printf("Waiting %s before the first scan\n", delay)
+		time.Sleep(delay)
+	}
+
+	//
+	// If we're running once, from cron or similar, then poll the feeds,
+	// push our metrics, and exit.
+	//
+	if *once {
+		checkFeeds()
+		updateSeenMetrics()
+		err := pushMetrics()
+		if err != nil {
+			fmt.Printf("Error pushing metrics to %s - %s\n", Pushgateway, err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+	if Pushgateway != "" {
+		fmt.Printf("Ignoring -pushgateway, which is only used with -once\n")
+	}
+
+	//
+	// Catch ctrl-c, etc, from now on, so that we may wait for any
+	// deliveries in progress before exiting.
 	//
 	sigs := make(chan os.Signal, 1)
-	done := make(chan bool, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	//
+	// Make the initial scan of feeds immediately to avoid waiting too
+	// long for the first time, and repeat it every five minutes.
+	//
+	c := cron.New()
+	c.AddFunc("@every 5m", func() {
+		checkFeeds()
+		updateSeenMetrics()
+	})
+	c.Start()
+	go func() {
+		checkFeeds()
+		updateSeenMetrics()
+	}()
+
+	//
+	// Send a test item to each hook upon receipt of SIGUSR2.
+	//
+	test := make(chan os.Signal, 1)
+	signal.Notify(test, syscall.SIGUSR2)
+	go func() {
+		for range test {
+			sendTestItems()
+		}
+	}()
+
+	//
+	// Reload our secrets upon receipt of SIGHUP, so that they may be
+	// rotated without a restart.
+	//
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
 	go func() {
-		_ = <-sigs
-		done <- true
+		for range hup {
+			err := loadSecrets()
+			if err != nil {
+				fmt.Printf("Error reloading secrets, keeping those loaded - %s\n", err.Error())
+				continue
+			}
+			if SecretsFile != "" {
+				fmt.Printf("Reloaded secrets from %s\n", SecretsFile)
+			}
+		}
 	}()
-	<-done
+
+	//
+	// Now we can loop waiting to be terminated via ctrl-c, etc, and
+	// then shut down gracefully.
+	//
+	<-sigs
+	fmt.Printf("Shutting down\n")
+	drain(c, sigs)
 }
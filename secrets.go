@@ -0,0 +1,127 @@
+// secrets.go contains the code which authenticates with hooks using API
+// keys held in a separate secrets file, so that the configuration file
+// needn't contain credentials:
+//
+//    # /etc/rss2hook/secrets, readable only by rss2hook
+//    slack-prod = xoxb-1234
+//
+//    https://example.com/feed.rss = https://hooks.example.com/notify
+//     - auth-secret: slack-prod
+//     - auth-header: X-Api-Key
+//
+// The secret is sent as a bearer token, via the Authorization header,
+// unless auth-header names another header, in which case it is sent
+// as-is.  The file, given by -secrets-file, is reloaded upon SIGHUP.
+//
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// SecretsFile is the file from which named secrets are loaded, if set.
+var SecretsFile string
+
+// secrets holds the secrets loaded from SecretsFile, keyed by name.
+var secrets = struct {
+	sync.RWMutex
+	values map[string]string
+}{}
+
+// readSecrets reads the named file of secrets, one "name = value" pair
+// per line, ignoring blank lines and comments.
+func readSecrets(filename string) (map[string]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// The file is meant to be locked down, so say if it isn't.
+	if info, err := file.Stat(); err == nil && info.Mode().Perm()&0077 != 0 {
+		fmt.Printf("Warning: %s is readable by other users\n", filename)
+	}
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		parts := strings.SplitN(text, "=", 2)
+		name := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || name == "" {
+			return nil, fmt.Errorf("%s:%d: expected 'name = value'", filename, line)
+		}
+		values[name] = strings.TrimSpace(parts[1])
+	}
+	return values, scanner.Err()
+}
+
+// loadSecrets (re)loads SecretsFile, reporting any secret named by the
+// feeds we monitor which it lacks.
+//
+// If the file can't be read the secrets previously loaded are kept.
+func loadSecrets() error {
+	if SecretsFile == "" {
+		return nil
+	}
+
+	values, err := readSecrets(SecretsFile)
+	if err != nil {
+		return err
+	}
+
+	secrets.Lock()
+	secrets.values = values
+	secrets.Unlock()
+
+	for _, entry := range loadedEntries() {
+		if entry.authSecret != "" && values[entry.authSecret] == "" {
+			fmt.Printf("Warning: the secret %s, used by %s, is not in %s\n",
+				entry.authSecret, redactCredentials(entry.feed), SecretsFile)
+		}
+	}
+	return nil
+}
+
+// lookupSecret returns the named secret.
+func lookupSecret(name string) (string, error) {
+	secrets.RLock()
+	defer secrets.RUnlock()
+
+	value := secrets.values[name]
+	if value == "" {
+		return "", fmt.Errorf("no secret named %s", name)
+	}
+	return value, nil
+}
+
+// setSecretAuth adds the secret of the given entry, if it has one, to
+// the request made to its hook.
+func setSecretAuth(entry RSSEntry, req *http.Request) error {
+	if entry.authSecret == "" {
+		return nil
+	}
+
+	value, err := lookupSecret(entry.authSecret)
+	if err != nil {
+		return err
+	}
+	if entry.authHeader == "" {
+		req.Header.Set("Authorization", "Bearer "+value)
+	} else {
+		addSecretHeader(entry.authHeader)
+		req.Header.Set(entry.authHeader, value)
+	}
+	return nil
+}
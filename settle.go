@@ -0,0 +1,104 @@
+// settle.go contains the code which delays the notification of new items
+// until they've settled, for feeds which publish drafts that are quickly
+// edited, or deleted:
+//
+//    https://example.com/feed.rss = https://example.com/hook
+//     - settle: 10m
+//
+// A new item is held as pending when it is first seen, and notified only
+// once it has remained in the feed, unchanged, for the settle period.
+// An item which changes starts settling again, and one which vanishes
+// before it settles is never notified.
+//
+
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// pendingItem is a new item which hasn't yet settled.
+type pendingItem struct {
+	// Since is the time the item was first seen in its current form.
+	Since time.Time `json:"since"`
+
+	// Hash identifies the content of the item, so that changes to it
+	// are noticed.
+	Hash string `json:"hash"`
+}
+
+// itemHash returns a hash of the content of the given item.
+func itemHash(item *gofeed.Item) string {
+	hasher := sha1.New()
+	for _, field := range []string{item.Title, item.Link, item.Description, item.Content} {
+		hasher.Write([]byte(field))
+		hasher.Write([]byte{0})
+	}
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// settling returns true if the given new item, of the given entry, has
+// not yet remained unchanged for the entry's settle period, recording
+// it as pending if it is new, or has changed.
+func settling(entry RSSEntry, item *gofeed.Item) bool {
+	if entry.settle <= 0 {
+		return false
+	}
+
+	parent := seenParent(entry)
+	state := loadFeedState(parent)
+	key := seenKey(entry, item)
+	hash := itemHash(item)
+
+	pending, ok := state.Pending[key]
+	if ok && pending.Hash == hash {
+		return time.Since(pending.Since) < entry.settle
+	}
+	if ok {
+		debug("%s changed while settling\n", itemName(item))
+	}
+
+	if state.Pending == nil {
+		state.Pending = make(map[string]pendingItem)
+	}
+	state.Pending[key] = pendingItem{Since: time.Now(), Hash: hash}
+	err := saveFeedState(parent, state)
+	if err != nil {
+		fmt.Printf("Error saving state of %s - %s\n", redactCredentials(parent), err.Error())
+	}
+	return true
+}
+
+// prunePending forgets the pending items of the given entry which have
+// vanished from its feed, or have since been notified; the given items
+// are those currently in the feed.
+func prunePending(entry RSSEntry, items []*gofeed.Item) {
+	parent := seenParent(entry)
+	state := loadFeedState(parent)
+	if len(state.Pending) == 0 {
+		return
+	}
+
+	current := make(map[string]bool)
+	for _, i := range items {
+		if needsNotify(entry, i) {
+			current[seenKey(entry, i)] = true
+		}
+	}
+	for key := range state.Pending {
+		if !current[key] {
+			debug("Forgetting pending item %s of %s\n", key, redactCredentials(parent))
+			delete(state.Pending, key)
+		}
+	}
+
+	err := saveFeedState(parent, state)
+	if err != nil {
+		fmt.Printf("Error saving state of %s - %s\n", redactCredentials(parent), err.Error())
+	}
+}
@@ -0,0 +1,66 @@
+// shutdown.go contains the code which shuts down gracefully, so that an
+// item isn't notified without being recorded as seen, or recorded when
+// its delivery was cut off, by a restart.
+//
+// Upon SIGINT, or SIGTERM, no further feeds are polled, and no further
+// items delivered, but a delivery in progress is given up to
+// -shutdown-grace to finish, and be recorded, before we exit.  A second
+// signal exits immediately.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/robfig/cron"
+)
+
+// ShutdownGrace is the longest we wait, upon shutdown, for a poll in
+// progress to finish.
+var ShutdownGrace time.Duration
+
+// shuttingDown is set, atomically, once we've begun to shut down.
+var shuttingDown int32
+
+// stopping returns true if we're shutting down, and so should poll no
+// further feeds, nor deliver any further items.
+func stopping() bool {
+	return atomic.LoadInt32(&shuttingDown) != 0
+}
+
+// drain stops the given scheduler, along with any poll in progress, and
+// waits for the delivery it is making to finish, for up to ShutdownGrace
+// or until a further signal is received upon the given channel.
+//
+// ScanLock is held when this returns, so that no further poll, such as
+// one requested via the admin API, may start.
+func drain(c *cron.Cron, sigs chan os.Signal) {
+	atomic.StoreInt32(&shuttingDown, 1)
+	c.Stop()
+
+	idle := make(chan struct{})
+	go func() {
+		ScanLock.Lock()
+		close(idle)
+	}()
+
+	select {
+	case <-idle:
+		return
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	fmt.Printf("Waiting up to %s for the delivery in progress to finish\n", ShutdownGrace)
+	select {
+	case <-idle:
+		fmt.Printf("Delivery finished\n")
+	case <-time.After(ShutdownGrace):
+		fmt.Printf("Delivery still in progress after %s, exiting\n", ShutdownGrace)
+	case <-sigs:
+		fmt.Printf("Exiting immediately\n")
+	}
+}
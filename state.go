@@ -0,0 +1,212 @@
+// state.go contains the state we persist for each feed, between
+// polls and across restarts.
+//
+
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// MaxKeysPerFeed limits the number of seen-keys retained for each feed,
+// zero disables the limit.
+var MaxKeysPerFeed int
+
+// StaleAfter is the duration after which a feed which hasn't produced
+// a new item is reported as stale, zero disables the check.
+var StaleAfter time.Duration
+
+// feedState is the state we persist for a single feed.
+type feedState struct {
+	// PausedUntil suppresses polling of the feed until the given time.
+	PausedUntil time.Time `json:"pausedUntil"`
+
+	// LastNewItem is the time the feed last produced a new item, or
+	// when we first polled it.
+	LastNewItem time.Time `json:"lastNewItem"`
+
+	// SeenKeys holds the keys of the items recorded as seen, oldest
+	// first, if the number retained is limited.
+	SeenKeys []string `json:"seenKeys,omitempty"`
+
+	// Links holds the links of the items in the feed when it was last
+	// polled.
+	Links []string `json:"links,omitempty"`
+
+	// FirstPoll is the time the feed was first polled, once its
+	// first-run policy has been applied.
+	FirstPoll time.Time `json:"firstPoll,omitempty"`
+
+	// NewestItem is the time of the newest item seen in the feed, if
+	// it is in monotonic mode.
+	NewestItem time.Time `json:"newestItem,omitempty"`
+
+	// Delivered holds the time each item was last delivered, keyed by
+	// its seen-key, if the feed has a cooldown.
+	Delivered map[string]time.Time `json:"delivered,omitempty"`
+
+	// Pending holds the new items which haven't yet settled, keyed by
+	// their seen-keys, if the feed has a settle period.
+	Pending map[string]pendingItem `json:"pending,omitempty"`
+
+	// Hashes holds the hashes of the content of the items in the feed,
+	// keyed by their seen-keys, if changes to them are notified.
+	Hashes map[string]string `json:"hashes,omitempty"`
+
+	// Validators holds what is needed to make a conditional request for
+	// the feed, keyed by hook.
+	Validators map[string]validator `json:"validators,omitempty"`
+
+	// ParseFailures is the number of consecutive polls upon which the
+	// feed was fetched, but couldn't be parsed.
+	ParseFailures int `json:"parseFailures,omitempty"`
+
+	// ParseRetryAt suppresses polling of a feed which failed to parse
+	// until the given time.
+	ParseRetryAt time.Time `json:"parseRetryAt,omitempty"`
+}
+
+// feedStateFile returns the path of the file holding the state of the
+// given feed.
+func feedStateFile(feed string) string {
+	hasher := sha1.New()
+	hasher.Write([]byte(feed))
+
+	return os.Getenv("HOME") + "/.rss2hook/feeds/" + hex.EncodeToString(hasher.Sum(nil))
+}
+
+// loadFeedState returns the state of the given feed.
+//
+// If no state has been saved for the feed an empty state is returned.
+func loadFeedState(feed string) feedState {
+	var state feedState
+
+	data, err := ioutil.ReadFile(feedStateFile(feed))
+	if err != nil {
+		return state
+	}
+	_ = json.Unmarshal(data, &state)
+	return state
+}
+
+// saveFeedState persists the state of the given feed.
+func saveFeedState(feed string, state feedState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	file := feedStateFile(feed)
+	err = os.MkdirAll(filepath.Dir(file), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0644)
+}
+
+// pauseFeed suppresses polling of the given feed for the specified
+// duration.  A zero duration resumes polling immediately.
+func pauseFeed(feed string, duration time.Duration) error {
+	state := loadFeedState(feed)
+	state.PausedUntil = time.Now().Add(duration)
+	return saveFeedState(feed, state)
+}
+
+// checkFreshness records the time at which the given feed last produced
+// a new item, warning if that was longer ago than StaleAfter, and exports
+// both that time and whether the feed is stale as metrics.
+func checkFreshness(feed string, produced bool) {
+	state := loadFeedState(feed)
+
+	if produced || state.LastNewItem.IsZero() {
+		state.LastNewItem = time.Now()
+		err := saveFeedState(feed, state)
+		if err != nil {
+			fmt.Printf("Error saving state of %s - %s\n", redactCredentials(feed), err.Error())
+		}
+	}
+
+	stale := 0.0
+	if StaleAfter > 0 && time.Since(state.LastNewItem) > StaleAfter {
+		stale = 1
+		fmt.Printf("Warning: %s has produced no new items since %s\n",
+			redactCredentials(feed), state.LastNewItem.Format(time.RFC3339))
+	}
+
+	setMetric(metricName("rss2hook_feed_last_new_item_timestamp_seconds", "feed", redactCredentials(feed)),
+		float64(state.LastNewItem.Unix()))
+	setMetric(metricName("rss2hook_feed_stale", "feed", redactCredentials(feed)), stale)
+}
+
+// trackSeenKey records that the given key is the one most recently seen
+// for the given feed, so that the oldest keys may later be pruned.
+//
+// The feed is identified by the key under which its items are recorded,
+// see seenParent, so that its keys are retained if its URL changes.
+//
+// A key which is recorded again, as when a changed item is notified
+// again, is moved rather than repeated.
+func trackSeenKey(parent string, key string) {
+	state := loadFeedState(parent)
+
+	keys := state.SeenKeys[:0]
+	for _, k := range state.SeenKeys {
+		if k != key {
+			keys = append(keys, k)
+		}
+	}
+	state.SeenKeys = append(keys, key)
+
+	err := saveFeedState(parent, state)
+	if err != nil {
+		fmt.Printf("Error saving state of %s - %s\n", redactCredentials(parent), err.Error())
+	}
+}
+
+// pruneSeenKeys removes the oldest seen-keys of the given feed, so that
+// no more than MaxKeysPerFeed are retained.
+//
+// The keys of the given items, those currently in the feed, are always
+// retained, as removing them would cause the items to be notified again.
+func pruneSeenKeys(entry RSSEntry, items []*gofeed.Item) {
+	parent := seenParent(entry)
+	state := loadFeedState(parent)
+	excess := len(state.SeenKeys) - MaxKeysPerFeed
+	if excess <= 0 {
+		return
+	}
+
+	current := make(map[string]bool)
+	for _, i := range items {
+		current[seenKey(entry, i)] = true
+	}
+
+	var kept []string
+	for _, key := range state.SeenKeys {
+		if excess > 0 && !current[key] {
+			excess--
+			debug("Pruning seen-key %s of %s\n", key, redactCredentials(parent))
+			err := os.Remove(filepath.Join(seenDir(), key))
+			if err == nil || os.IsNotExist(err) {
+				continue
+			}
+			fmt.Printf("Error pruning seen-key %s of %s - %s\n", key, redactCredentials(parent), err.Error())
+		}
+		kept = append(kept, key)
+	}
+	state.SeenKeys = kept
+
+	err := saveFeedState(parent, state)
+	if err != nil {
+		fmt.Printf("Error saving state of %s - %s\n", redactCredentials(parent), err.Error())
+	}
+}
@@ -0,0 +1,58 @@
+// status.go contains the code which decides whether the status-code
+// returned by a webhook indicates a successful delivery.
+//
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// parseStatusCodes parses a comma-separated list of status-codes, each
+// of which is either a number, or a class of codes such as "2xx".
+func parseStatusCodes(list string) ([]string, error) {
+	valid := regexp.MustCompile(`^[1-5]([0-9]{2}|xx)$`)
+
+	var codes []string
+	for _, code := range strings.Split(list, ",") {
+		code = strings.ToLower(strings.TrimSpace(code))
+		if !valid.MatchString(code) {
+			return nil, fmt.Errorf("invalid status-code '%s'", code)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// statusAccepted returns true if the status-code matches one of the
+// given codes, or is any 2xx code if none are given.
+func statusAccepted(status int, codes []string) bool {
+	if len(codes) == 0 {
+		codes = []string{"2xx"}
+	}
+
+	for _, code := range codes {
+		if strings.HasSuffix(code, "xx") {
+			if strconv.Itoa(status/100) == code[:1] {
+				return true
+			}
+		} else if strconv.Itoa(status) == code {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptStatus returns a function which rejects any delivery to the
+// hook of the given entry which returns an unacceptable status-code.
+func acceptStatus(entry RSSEntry) func(int, []byte) error {
+	return func(status int, body []byte) error {
+		if statusAccepted(status, entry.successCodes) {
+			return nil
+		}
+		return fmt.Errorf("unexpected status-code %d", status)
+	}
+}
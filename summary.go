@@ -0,0 +1,138 @@
+// summary.go contains the code which posts a summary of each poll of
+// the feeds to a separate hook, given with -summary-hook, for dashboards
+// which would rather not follow every notification.
+//
+// The summary is posted once every feed has been polled, even if there
+// was nothing new, and looks like:
+//
+//    {"started": "2024-01-01T12:00:00Z", "duration": 4.2,
+//     "feeds": 12, "items": 3, "errors": 1,
+//     "updated": [{"feed": "https://example.com/feed.rss",
+//                  "title": "Example", "items": 3}]}
+//
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// SummaryHook is the hook to which a summary of each poll is posted, if
+// it is set.
+var SummaryHook string
+
+// summaryFeed describes a feed with items notified during a poll.
+type summaryFeed struct {
+	Feed  string `json:"feed"`
+	Title string `json:"title,omitempty"`
+	Items int    `json:"items"`
+}
+
+// cycleSummary is the summary of a single poll of the feeds.
+type cycleSummary struct {
+	// Started is when the poll started, and Duration how many seconds
+	// it took.
+	Started  time.Time `json:"started"`
+	Duration float64   `json:"duration"`
+
+	// Feeds is the number of feeds read, Items the number of items
+	// notified, and Errors the number of feeds which couldn't be read
+	// along with the number of notifications which failed.
+	Feeds  int `json:"feeds"`
+	Items  int `json:"items"`
+	Errors int `json:"errors"`
+
+	// Updated describes the feeds with items notified.
+	Updated []summaryFeed `json:"updated"`
+
+	// titles holds the titles of the feeds read, and updated the
+	// number of items notified for each, keyed by URL.
+	titles  map[string]string
+	updated map[string]int
+}
+
+// summary is the summary of the current poll.
+//
+// The caller must hold ScanLock to access it.
+var summary cycleSummary
+
+// startSummary begins the summary of a poll.
+func startSummary() {
+	summary = cycleSummary{
+		Started: time.Now(),
+		titles:  make(map[string]string),
+		updated: make(map[string]int),
+	}
+}
+
+// summarizeRead records that the feed of the given entry was read, with
+// the given result.
+func summarizeRead(entry RSSEntry, feed *gofeed.Feed, err error) {
+	if summary.titles == nil {
+		return
+	}
+
+	summary.Feeds++
+	if err != nil && err != errNotModified {
+		summary.Errors++
+	}
+	if feed != nil {
+		summary.titles[entry.feed] = feed.Title
+	}
+}
+
+// summarizeNotify records that the given number of items, of the given
+// entry, were notified, with the given result.
+func summarizeNotify(entry RSSEntry, items int, err error) {
+	if summary.titles == nil {
+		return
+	}
+
+	if err != nil {
+		summary.Errors++
+		return
+	}
+	summary.Items += items
+	summary.updated[entry.feed] += items
+}
+
+// sendSummary posts the summary of the current poll to SummaryHook.
+func sendSummary() {
+	if SummaryHook == "" || summary.titles == nil {
+		return
+	}
+
+	summary.Duration = time.Since(summary.Started).Seconds()
+	summary.Updated = []summaryFeed{}
+	for feed, items := range summary.updated {
+		summary.Updated = append(summary.Updated, summaryFeed{
+			Feed: redactCredentials(feed), Title: summary.titles[feed], Items: items,
+		})
+	}
+	sort.Slice(summary.Updated, func(a, b int) bool {
+		return summary.Updated[a].Feed < summary.Updated[b].Feed
+	})
+
+	jsonValue, err := json.Marshal(summary)
+	if err != nil {
+		fmt.Printf("Error encoding summary - %s\n", err.Error())
+		return
+	}
+
+	entry, err := newEntry("", SummaryHook)
+	if err != nil {
+		fmt.Printf("Error posting summary - %s\n", err.Error())
+		return
+	}
+	entry = resolveOptions(entry)
+
+	err = postJSON(entry, entry.hook, jsonValue)
+	if err != nil {
+		fmt.Printf("Error posting summary to %s - %s\n", entry.hook, err.Error())
+	}
+}
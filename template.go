@@ -0,0 +1,93 @@
+// template.go contains the code for hooks whose URL is a template,
+// rendered for each item, for example:
+//
+//    https://api.example.com/articles/{{.GUID}}
+//
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// escapeValue URL-escapes a value interpolated into a hook URL.
+//
+// Spaces are encoded as "%20", rather than "+", so the result is safe
+// to use in both the path and the query-string.
+func escapeValue(value string) string {
+	return strings.Replace(url.QueryEscape(value), "+", "%20", -1)
+}
+
+// escapeActions rewrites the actions beneath the given node, so that
+// their output is passed through escapeValue.
+func escapeActions(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			escapeActions(child)
+		}
+	case *parse.ActionNode:
+		// Variable declarations produce no output.
+		if len(n.Pipe.Decl) == 0 {
+			escape := &parse.CommandNode{
+				NodeType: parse.NodeCommand,
+				Args:     []parse.Node{parse.NewIdentifier("escape")},
+			}
+			n.Pipe.Cmds = append(n.Pipe.Cmds, escape)
+		}
+	case *parse.IfNode:
+		escapeActions(n.List)
+		escapeActions(n.ElseList)
+	case *parse.RangeNode:
+		escapeActions(n.List)
+		escapeActions(n.ElseList)
+	case *parse.WithNode:
+		escapeActions(n.List)
+		escapeActions(n.ElseList)
+	}
+}
+
+// parseHookTemplate parses a hook URL which contains template-actions.
+func parseHookTemplate(hook string) (*template.Template, error) {
+	funcs := template.FuncMap{
+		"escape": func(value interface{}) string {
+			return escapeValue(fmt.Sprint(value))
+		},
+	}
+
+	tmpl, err := template.New("hook").Funcs(funcs).Parse(hook)
+	if err != nil {
+		return nil, err
+	}
+	escapeActions(tmpl.Tree.Root)
+	return tmpl, nil
+}
+
+// hookURL returns the URL to submit the given payload to; the entry's
+// hook, rendered if it is a template.
+//
+// The global hook-base, and hook-suffix, are applied to rendered hooks
+// here, since they can't be applied to the template itself.
+func hookURL(entry RSSEntry, payload *Payload) (string, error) {
+	if entry.hookTemplate == nil {
+		return entry.hook, nil
+	}
+
+	var buf bytes.Buffer
+	err := entry.hookTemplate.Execute(&buf, payload)
+	if err != nil {
+		return "", err
+	}
+	if entry.noHookBase || isUnixHook(buf.String()) {
+		return buf.String(), nil
+	}
+	return withHookBase(buf.String()), nil
+}
@@ -0,0 +1,51 @@
+// testitem.go contains the code for sending a synthetic item to each
+// of our hooks, to verify a running deployment can reach them.
+//
+// This is triggered by sending SIGUSR2 to the daemon.
+//
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// testItem returns the synthetic item sent to hooks.
+func testItem() *gofeed.Item {
+	now := time.Now()
+
+	return &gofeed.Item{
+		Title:           "rss2hook test notification",
+		Description:     "This is a test notification, sent by rss2hook upon receipt of SIGUSR2.",
+		Link:            "https://github.com/skx/rss2hook",
+		GUID:            fmt.Sprintf("rss2hook-test-%d", now.Unix()),
+		Published:       now.Format(time.RFC1123Z),
+		PublishedParsed: &now,
+	}
+}
+
+// sendTestItems sends a synthetic item to each distinct hook, logging
+// the result.
+//
+// The item is never recorded as seen.
+func sendTestItems() {
+	item := testItem()
+	seen := make(map[string]bool)
+
+	for _, entry := range loadedEntries() {
+		if seen[entry.hook] {
+			continue
+		}
+		seen[entry.hook] = true
+
+		err := notify(entry, item)
+		if err != nil {
+			fmt.Printf("Test notification to %s failed - %s\n", entry.hook, err.Error())
+			continue
+		}
+		fmt.Printf("Test notification to %s succeeded\n", entry.hook)
+	}
+}
@@ -0,0 +1,50 @@
+// title.go contains the code which rewrites the titles of items before
+// they're notified, so that items from several feeds which share a hook
+// may be told apart, for example:
+//
+//    https://news.ycombinator.com/rss = https://chat.example.com/hook
+//     - title-prefix: [HN]
+//
+// Filters, and expressions, see the original title.
+//
+
+package main
+
+import (
+	"bytes"
+	"text/template"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// parseTitleTemplate parses a template used to render titles.
+func parseTitleTemplate(value string) (*template.Template, error) {
+	return template.New("title").Parse(value)
+}
+
+// retitleItem returns the given item with its title rewritten by the
+// title-template, and title-prefix, of the given entry.
+//
+// The item is copied, rather than modified, if its title changes.
+func retitleItem(entry RSSEntry, item *gofeed.Item) (*gofeed.Item, error) {
+	if entry.titleTemplate == nil && entry.titlePrefix == "" {
+		return item, nil
+	}
+
+	title := item.Title
+	if entry.titleTemplate != nil {
+		var buf bytes.Buffer
+		err := entry.titleTemplate.Execute(&buf, item)
+		if err != nil {
+			return nil, err
+		}
+		title = buf.String()
+	}
+	if entry.titlePrefix != "" {
+		title = entry.titlePrefix + " " + title
+	}
+
+	retitled := *item
+	retitled.Title = title
+	return &retitled, nil
+}
@@ -0,0 +1,128 @@
+// trace.go contains the code which logs the requests we make to our
+// webhooks, and the responses they return, to aid debugging.
+//
+// Tracing is disabled by default, since the bodies logged may contain
+// sensitive content.  Headers known to carry secrets are redacted.
+//
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+)
+
+// TraceHooks is set if we should log every request made to a webhook,
+// along with the response it returned.
+var TraceHooks bool
+
+// secretHeaders are the headers whose values are never logged; those
+// which always carry secrets, along with any named by auth-header.
+var secretHeaders = struct {
+	sync.Mutex
+	names map[string]bool
+}{names: map[string]bool{
+	"Authorization":        true,
+	"Proxy-Authorization":  true,
+	"Cookie":               true,
+	"X-Gotify-Key":         true,
+	"X-Amz-Security-Token": true,
+}}
+
+// addSecretHeader records that the named header carries a secret.
+func addSecretHeader(name string) {
+	secretHeaders.Lock()
+	defer secretHeaders.Unlock()
+
+	secretHeaders.names[http.CanonicalHeaderKey(name)] = true
+}
+
+// isSecretHeader returns true if the named header carries a secret.
+func isSecretHeader(name string) bool {
+	secretHeaders.Lock()
+	defer secretHeaders.Unlock()
+
+	return secretHeaders.names[http.CanonicalHeaderKey(name)]
+}
+
+// traceTransport wraps a transport, logging each request and response.
+type traceTransport struct {
+	next http.RoundTripper
+}
+
+// traceHeaders prints the given headers, sorted by name, with the
+// values of any secret headers redacted.
+func traceHeaders(prefix string, headers http.Header) {
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, value := range headers[name] {
+			if isSecretHeader(name) {
+				value = "[redacted]"
+			}
+			fmt.Printf("%s%s: %s\n", prefix, name, value)
+		}
+	}
+}
+
+// redactURL returns the given URL as a string, with any password
+// it contains redacted.
+func redactURL(u *url.URL) string {
+	if u.User == nil {
+		return u.String()
+	}
+	if _, ok := u.User.Password(); !ok {
+		return u.String()
+	}
+
+	redacted := *u
+	redacted.User = url.UserPassword(u.User.Username(), "xxxxx")
+	return redacted.String()
+}
+
+// RoundTrip logs the request, performs it, and then logs the response.
+func (t traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	fmt.Printf("trace: > %s %s\n", req.Method, redactURL(req.URL))
+	traceHeaders("trace: > ", req.Header)
+
+	// Read a copy of the body, leaving the original for the transport.
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err == nil {
+			data, _ := ioutil.ReadAll(body)
+			body.Close()
+			fmt.Printf("trace: > %s\n", data)
+		}
+	}
+
+	res, err := t.next.RoundTrip(req)
+	if err != nil {
+		fmt.Printf("trace: < error - %s\n", err.Error())
+		return res, err
+	}
+
+	fmt.Printf("trace: < %s\n", res.Status)
+	traceHeaders("trace: < ", res.Header)
+
+	// Read the body, and replace it so that the caller may read it too.
+	data, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	res.Body = ioutil.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		fmt.Printf("trace: < error reading body - %s\n", err.Error())
+		return res, nil
+	}
+	fmt.Printf("trace: < %s\n", data)
+
+	return res, nil
+}
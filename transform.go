@@ -0,0 +1,92 @@
+// transform.go contains the code which passes the JSON object posted to
+// a hook through an external service first, which may enrich or reshape
+// it, for feeds with the transform-hook option:
+//
+//    https://example.com/feed.rss = https://example.com/hook
+//     - transform-hook: https://enrich.example.com/transform
+//
+// The object is posted to the transform hook, and the JSON it returns is
+// posted to the hook in its place.  If the transform fails the original
+// object is posted, unless the transform-failure option is "fail", in
+// which case the delivery fails and is retried upon the next poll.
+//
+// The transform is subject to the hook timeout of the feed, and to the
+// limits of -hook-rate and -hook-concurrency.  It is skipped when the
+// requests are written to -output-dir.
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// transformLimit is the largest response accepted from a transform hook.
+const transformLimit = 10 * 1024 * 1024
+
+// transform posts the given JSON object to the transform hook of the
+// given entry, returning the JSON it responds with.
+//
+// The request is made via deliverOnce, so that it is subject to the
+// delays, and limits, of deliveries to other hooks.
+func transform(entry RSSEntry, jsonValue []byte) ([]byte, error) {
+	req, err := http.NewRequest("POST", entry.transformHook, bytes.NewReader(jsonValue))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	var transformed []byte
+	err = deliverOnce(hookClient(entry), req, func(status int, body []byte) error {
+		if status < 200 || status > 299 {
+			return fmt.Errorf("unexpected status-code %d", status)
+		}
+		if len(body) > transformLimit {
+			return fmt.Errorf("the response is larger than %d bytes", transformLimit)
+		}
+		if !json.Valid(body) {
+			return fmt.Errorf("the response is not valid JSON")
+		}
+		transformed = body
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transformed, nil
+}
+
+// transformPayload returns the given JSON object, as transformed by the
+// transform hook of the given entry, if it has one.
+//
+// If the transform fails the object is returned unchanged, unless the
+// entry's transform-failure option is "fail".  The transform is skipped
+// when writing requests to OutputDir, rather than making them.
+func transformPayload(entry RSSEntry, jsonValue []byte) ([]byte, error) {
+	if entry.transformHook == "" {
+		return jsonValue, nil
+	}
+
+	// Nothing is submitted when writing our requests to disk.
+	if OutputDir != "" {
+		debug("Not transforming the item via %s, as we're writing to %s\n",
+			redactCredentials(entry.transformHook), OutputDir)
+		return jsonValue, nil
+	}
+
+	transformed, err := transform(entry, jsonValue)
+	if err == nil {
+		return transformed, nil
+	}
+
+	fmt.Printf("notify: Failed to transform the item via %s - %s\n",
+		redactCredentials(entry.transformHook), err.Error())
+	if entry.transformFailure == "fail" {
+		return nil, err
+	}
+	return jsonValue, nil
+}